@@ -0,0 +1,170 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package canonical serializes JSON content in the canonical form
+// recommended by considerations.md, as described in
+// http://wiki.laptop.org/go/Canonical_JSON:
+// object keys are sorted, there is no insignificant whitespace,
+// only '"' and '\' are escaped in strings and numbers are integers.
+package canonical
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NotCanonicalError is returned by Check for valid JSON documents
+// which are not in canonical form.
+type NotCanonicalError struct {
+	// Offset is the byte offset of the first difference between
+	// the document and its canonical form.
+	Offset int64
+}
+
+func (e NotCanonicalError) Error() string {
+	return fmt.Sprintf("not canonical JSON, first difference at byte %d", e.Offset)
+}
+
+// UnsupportedValueError is returned for valid JSON documents holding
+// a value which has no canonical form, such as a floating point number.
+type UnsupportedValueError struct {
+	Value string
+}
+
+func (e UnsupportedValueError) Error() string {
+	return fmt.Sprintf("no canonical form for value %s", e.Value)
+}
+
+// Marshal returns the canonical JSON encoding of v, which is first
+// encoded with encoding/json. It works for the specs-go/v1 types
+// as well as for any other value encoding/json supports.
+func Marshal(v interface{}) ([]byte, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(p)
+}
+
+// Canonicalize returns the canonical form of the JSON document p.
+func Canonicalize(p []byte) ([]byte, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON")
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON: data after the top-level value")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encode(buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Check returns nil if the JSON document p is in canonical form
+// and a NotCanonicalError if it is not. Other errors are returned
+// if p is not valid JSON or has no canonical form.
+func Check(p []byte) error {
+	canonical, err := Canonicalize(p)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(p, canonical) {
+		return nil
+	}
+
+	offset := 0
+	for offset < len(p) && offset < len(canonical) && p[offset] == canonical[offset] {
+		offset++
+	}
+	return NotCanonicalError{Offset: int64(offset)}
+}
+
+// encode writes v, as decoded by encoding/json with UseNumber, in canonical form.
+func encode(w *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("null")
+	case bool:
+		if v {
+			w.WriteString("true")
+		} else {
+			w.WriteString("false")
+		}
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return UnsupportedValueError{Value: string(v)}
+		}
+		i, ok := new(big.Int).SetString(string(v), 10)
+		if !ok {
+			return UnsupportedValueError{Value: string(v)}
+		}
+		w.WriteString(i.String())
+	case string:
+		w.WriteByte('"')
+		for i := 0; i < len(v); i++ {
+			if v[i] == '"' || v[i] == '\\' {
+				w.WriteByte('\\')
+			}
+			w.WriteByte(v[i])
+		}
+		w.WriteByte('"')
+	case []interface{}:
+		w.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := encode(w, e); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := encode(w, k); err != nil {
+				return err
+			}
+			w.WriteByte(':')
+			if err := encode(w, v[k]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+	default:
+		return errors.Errorf("unexpected type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package canonical
+
+import (
+	"testing"
+
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestMarshal(t *testing.T) {
+	manifest := v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config: v1.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    "sha256:6f4e69a5ff18d92e7315e3ee31c62165ebf25bfa05cad05c0d09d8f412dae401",
+			Size:      1470,
+		},
+		Layers: []v1.Descriptor{},
+		Annotations: map[string]string{
+			"org.example.b": "<b & \"c\">",
+			"org.example.a": "a\\",
+		},
+	}
+
+	p, err := Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"annotations":{"org.example.a":"a\\","org.example.b":"<b & \"c\">"},` +
+		`"config":{"digest":"sha256:6f4e69a5ff18d92e7315e3ee31c62165ebf25bfa05cad05c0d09d8f412dae401",` +
+		`"mediaType":"application/vnd.oci.image.config.v1+json","size":1470},"layers":[],"schemaVersion":2}`
+	if string(p) != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, p)
+	}
+	if err := Check(p); err != nil {
+		t.Errorf("marshaled document is not canonical: %v", err)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	for i, tt := range []struct {
+		input    string
+		expected string
+		fail     bool
+	}{
+		{input: `null`, expected: `null`},
+		{input: ` { "b" : [ 1, true, false, null ], "a" : {} } `, expected: `{"a":{},"b":[1,true,false,null]}`},
+		{input: `"é\n\/\"\\"`, expected: "\"é\n/\\\"\\\\\""},
+		{input: `{"é":1,"z":2,"A":3}`, expected: `{"A":3,"z":2,"é":1}`},
+		{input: `-0`, expected: `0`},
+		{input: `123456789012345678901234567890`, expected: `123456789012345678901234567890`},
+
+		// expected failure: floating point numbers have no canonical form
+		{input: `1.5`, fail: true},
+		{input: `{"a":[1e3]}`, fail: true},
+
+		// expected failure: invalid JSON
+		{input: `{"a":`, fail: true},
+		{input: `{} {}`, fail: true},
+	} {
+		p, err := Canonicalize([]byte(tt.input))
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected an error but got %s", i, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if string(p) != tt.expected {
+			t.Errorf("test %d: expected %s but got %s", i, tt.expected, p)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for i, tt := range []struct {
+		input  string
+		offset int64
+		err    bool
+	}{
+		{input: `{"a":1,"b":[]}`, offset: -1},
+		{input: `{"a":1, "b":[]}`, offset: 7},
+		{input: `{"b":[],"a":1}`, offset: 2},
+		{input: `{"a":"\u003c"}`, offset: 6},
+		{input: `{"a":1}` + "\n", offset: 7},
+		{input: `[1.0]`, err: true},
+	} {
+		err := Check([]byte(tt.input))
+		switch {
+		case tt.err:
+			if _, ok := errors.Cause(err).(UnsupportedValueError); !ok {
+				t.Errorf("test %d: expected an unsupported value error but got %v", i, err)
+			}
+		case tt.offset < 0:
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %v", i, err)
+			}
+		default:
+			nerr, ok := err.(NotCanonicalError)
+			if !ok {
+				t.Errorf("test %d: expected a not canonical error but got %v", i, err)
+				continue
+			}
+			if nerr.Offset != tt.offset {
+				t.Errorf("test %d: expected first difference at byte %d but got %d", i, tt.offset, nerr.Offset)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ebnf implements the subset of Extended Backus-Naur Form
+// defined in considerations.md, which is used for the field formats
+// of the specification. The grammars are regular and can be compiled
+// into a single regular expression.
+package ebnf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Grammar is a parsed set of rules of the form "symbol ::= expression".
+type Grammar struct {
+	symbols []string
+	rules   map[string]*rule
+}
+
+type rule struct {
+	pos  position
+	expr expression
+}
+
+// position is a line and column in the grammar source, both starting at 1.
+type position struct {
+	line, col int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%d:%d", p.line, p.col)
+}
+
+// SyntaxError reports a grammar which cannot be parsed.
+type SyntaxError struct {
+	Line, Col int
+	Msg       string
+}
+
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("ebnf: %d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+// SymbolError reports an undefined, ambiguous or recursive symbol.
+// Line is the line of the offending reference or definition.
+type SymbolError struct {
+	Symbol string
+	Line   int
+	Msg    string
+}
+
+func (e SymbolError) Error() string {
+	return fmt.Sprintf("ebnf: line %d: symbol %q %s", e.Line, e.Symbol, e.Msg)
+}
+
+// GrammarError contains all the symbol errors found in a grammar.
+type GrammarError struct {
+	Errs []error
+}
+
+func (e GrammarError) Error() string {
+	return fmt.Sprintf("%v", e.Errs)
+}
+
+// Parse reads a grammar from r. Symbols which are defined more than
+// once are ambiguous and, like symbols which are used but not defined
+// or which refer to themselves, are reported in a GrammarError.
+func Parse(r io.Reader) (*Grammar, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the grammar")
+	}
+
+	p := &parser{lex: lexer{src: string(src), pos: position{1, 1}}}
+	p.next()
+	p.next()
+
+	g := &Grammar{rules: map[string]*rule{}}
+	var errs []error
+	for p.tok.kind != tokenEOF {
+		name := p.tok
+		if name.kind == tokenSymbol && p.peek.kind == tokenError {
+			return nil, p.errorf(p.peek, "")
+		}
+		if name.kind != tokenSymbol || p.peek.kind != tokenDefine {
+			return nil, p.errorf(name, "expected a rule of the form symbol ::= expression but found %s", name)
+		}
+		p.next()
+		p.next()
+
+		expr, err := p.parseAlternatives()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := g.rules[name.text]; ok {
+			errs = append(errs, SymbolError{Symbol: name.text, Line: name.pos.line, Msg: "is defined more than once and is ambiguous"})
+			continue
+		}
+		g.symbols = append(g.symbols, name.text)
+		g.rules[name.text] = &rule{pos: name.pos, expr: expr}
+	}
+
+	if len(g.symbols) == 0 {
+		return nil, p.errorf(p.tok, "grammar has no rules")
+	}
+
+	errs = append(errs, g.check()...)
+	if len(errs) > 0 {
+		return nil, GrammarError{Errs: errs}
+	}
+	return g, nil
+}
+
+// check returns an error for every reference to an undefined symbol
+// and for every symbol which refers to itself.
+func (g *Grammar) check() []error {
+	var errs []error
+	for _, name := range g.symbols {
+		walk(g.rules[name].expr, func(e expression) {
+			if ref, ok := e.(reference); ok {
+				if _, ok := g.rules[ref.name]; !ok {
+					errs = append(errs, SymbolError{Symbol: ref.name, Line: ref.pos.line, Msg: "is not defined"})
+				}
+			}
+		})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for _, name := range g.symbols {
+		if g.recursive(name, map[string]bool{}) {
+			errs = append(errs, SymbolError{Symbol: name, Line: g.rules[name].pos.line, Msg: "is recursive and cannot be converted to a regular expression"})
+		}
+	}
+	return errs
+}
+
+// recursive reports whether name refers, directly or indirectly, to
+// one of the symbols in path or to itself.
+func (g *Grammar) recursive(name string, path map[string]bool) bool {
+	if path[name] {
+		return true
+	}
+	path[name] = true
+	defer delete(path, name)
+
+	found := false
+	walk(g.rules[name].expr, func(e expression) {
+		if ref, ok := e.(reference); ok && !found {
+			found = g.recursive(ref.name, path)
+		}
+	})
+	return found
+}
+
+// Symbols returns the defined symbols in the order of their definition.
+func (g *Grammar) Symbols() []string {
+	return append([]string(nil), g.symbols...)
+}
+
+// Expression returns the regular expression syntax, as accepted by package
+// regexp, for the production identified by symbol. References to other
+// symbols are replaced by their expressions. The result is not anchored.
+func (g *Grammar) Expression(symbol string) (string, error) {
+	r, ok := g.rules[symbol]
+	if !ok {
+		return "", errors.Errorf("ebnf: symbol %q is not defined", symbol)
+	}
+	b := &bytes.Buffer{}
+	g.write(b, r.expr, precAlternatives)
+	return b.String(), nil
+}
+
+// Regexp compiles the production identified by symbol into a regular
+// expression which matches complete inputs only.
+func (g *Grammar) Regexp(symbol string) (*regexp.Regexp, error) {
+	expr, err := g.Expression(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebnf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	for i, tt := range []struct {
+		grammar  string
+		expected string
+	}{
+		{
+			grammar:  `literal ::= "matchthis"`,
+			expected: `matchthis`,
+		},
+		{
+			grammar:  `escaped ::= "a.b*"`,
+			expected: `a\.b\*`,
+		},
+		{
+			grammar:  `multipleranges ::= [a-zA-Z=-]`,
+			expected: `[a-zA-Z=\-]`,
+		},
+		{
+			grammar:  `special ::= [-^\]`,
+			expected: `[\-\^\\]`,
+		},
+		{
+			grammar:  "oneof ::= A | B\nA ::= \"a\"\nB ::= \"b\"",
+			expected: `a|b`,
+		},
+		{
+			grammar:  "symbol ::= A B | C D\nA ::= \"a\"\nB ::= \"b\"\nC ::= \"c\"\nD ::= \"dd\"",
+			expected: `ab|cdd`,
+		},
+		{
+			grammar:  "symbol ::= (A | B) \"c\"+\nA ::= \"a\"\nB ::= \"bb\"",
+			expected: `(?:a|bb)c+`,
+		},
+		{
+			grammar:  "symbol ::= A+ | B*\nA ::= \"aa\"\nB ::= [b]",
+			expected: `(?:aa)+|[b]*`,
+		},
+		{
+			grammar:  "symbol ::= (\"a\"+)*",
+			expected: `(?:a+)*`,
+		},
+		{
+			grammar:  "symbol ::= \"x\" \n    other\nother ::= \"y\" | \"z\"",
+			expected: `x(?:y|z)`,
+		},
+	} {
+		g, err := Parse(strings.NewReader(tt.grammar))
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		expr, err := g.Expression(g.Symbols()[0])
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if expr != tt.expected {
+			t.Errorf("test %d: expected %s but got %s", i, tt.expected, expr)
+		}
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	g, err := Parse(strings.NewReader(`
+path      ::= component ("/" component)*
+component ::= [a-z]+
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbols := g.Symbols(); !reflect.DeepEqual(symbols, []string{"path", "component"}) {
+		t.Errorf("unexpected symbols %v", symbols)
+	}
+
+	re, err := g.Regexp("path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, match := range map[string]bool{
+		"a":       true,
+		"foo/bar": true,
+		"":        false,
+		"/foo":    false,
+		"foo/":    false,
+		"foo/Bar": false,
+		"x foo":   false,
+	} {
+		if re.MatchString(input) != match {
+			t.Errorf("expected match=%t for %q", match, input)
+		}
+	}
+
+	if _, err := g.Regexp("missing"); err == nil {
+		t.Error("expected an error for an undefined symbol")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for i, tt := range []struct {
+		grammar string
+		symbols []string
+		line    int
+	}{
+		// syntax errors
+		{grammar: ``, line: 1},
+		{grammar: `symbol := "a"`, line: 1},
+		{grammar: `symbol ::=`, line: 1},
+		{grammar: "symbol ::= \"a\"\n  | ", line: 2},
+		{grammar: `symbol ::= ("a"`, line: 1},
+		{grammar: `symbol ::= "a`, line: 1},
+		{grammar: `symbol ::= ""`, line: 1},
+		{grammar: `symbol ::= "é"`, line: 1},
+		{grammar: `symbol ::= [^a]`, line: 1},
+		{grammar: `symbol ::= [z-a]`, line: 1},
+		{grammar: `symbol ::= []`, line: 1},
+		{grammar: "symbol ::= \"a\"\n\"b\" ::= \"c\"", line: 2},
+		{grammar: `symbol ::= "a" ? `, line: 1},
+
+		// symbol errors
+		{grammar: "a ::= b c\nc ::= \"c\"", symbols: []string{"b"}},
+		{grammar: "a ::= \"a\"\nb ::= \"b\"\na ::= \"c\"", symbols: []string{"a"}},
+		{grammar: "a ::= \"a\" a?", line: 1},
+		{grammar: "a ::= \"a\" a*", symbols: []string{"a"}},
+		{grammar: "a ::= b\nb ::= (\"b\" a)+", symbols: []string{"a", "b"}},
+	} {
+		_, err := Parse(strings.NewReader(tt.grammar))
+		if tt.symbols == nil {
+			serr, ok := err.(SyntaxError)
+			if !ok {
+				t.Errorf("test %d: expected a syntax error but got %v", i, err)
+			} else if serr.Line != tt.line {
+				t.Errorf("test %d: expected a syntax error at line %d but got %v", i, tt.line, err)
+			}
+			continue
+		}
+
+		gerr, ok := err.(GrammarError)
+		if !ok {
+			t.Errorf("test %d: expected a grammar error but got %v", i, err)
+			continue
+		}
+		var symbols []string
+		for _, err := range gerr.Errs {
+			symbols = append(symbols, err.(SymbolError).Symbol)
+		}
+		if !reflect.DeepEqual(symbols, tt.symbols) {
+			t.Errorf("test %d: expected errors for %v but got %v", i, tt.symbols, gerr)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebnf
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// expression is a node of the expression tree of a rule.
+// Groups do not have a node of their own.
+type expression interface{}
+
+type (
+	// literal matches its text exactly.
+	literal struct {
+		text string
+	}
+
+	// class matches a single character of its ranges.
+	class struct {
+		ranges []charRange
+	}
+
+	// reference matches the expression of the rule defining name.
+	reference struct {
+		name string
+		pos  position
+	}
+
+	// sequence matches all its expressions, one after the other.
+	sequence []expression
+
+	// alternatives matches one of its expressions.
+	alternatives []expression
+
+	// repetition matches expr zero or more times for the operator '*'
+	// and one or more times for the operator '+'.
+	repetition struct {
+		expr expression
+		op   byte
+	}
+)
+
+// charRange holds the characters from lo to hi, inclusive.
+type charRange struct {
+	lo, hi byte
+}
+
+// walk calls fn for e and for all expressions below it,
+// without following references.
+func walk(e expression, fn func(expression)) {
+	fn(e)
+	switch e := e.(type) {
+	case sequence:
+		for _, e := range e {
+			walk(e, fn)
+		}
+	case alternatives:
+		for _, e := range e {
+			walk(e, fn)
+		}
+	case repetition:
+		walk(e.expr, fn)
+	}
+}
+
+// Operator precedences, from the loosest to the tightest binding.
+const (
+	precAlternatives = iota
+	precSequence
+	precRepetition
+	precTerminal
+)
+
+// prec returns the precedence of the regular expression written for e.
+func (g *Grammar) prec(e expression) int {
+	switch e := e.(type) {
+	case literal:
+		if len(e.text) == 1 {
+			return precTerminal
+		}
+		return precSequence
+	case reference:
+		return g.prec(g.rules[e.name].expr)
+	case sequence:
+		return precSequence
+	case alternatives:
+		return precAlternatives
+	case repetition:
+		return precRepetition
+	}
+	return precTerminal
+}
+
+// write writes the regular expression for e to b, grouping it
+// if it binds looser than the operator it is an operand of.
+func (g *Grammar) write(b *bytes.Buffer, e expression, min int) {
+	if g.prec(e) < min {
+		b.WriteString("(?:")
+		g.write(b, e, precAlternatives)
+		b.WriteString(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case literal:
+		b.WriteString(regexp.QuoteMeta(e.text))
+	case class:
+		b.WriteByte('[')
+		for _, r := range e.ranges {
+			writeClassChar(b, r.lo)
+			if r.hi != r.lo {
+				b.WriteByte('-')
+				writeClassChar(b, r.hi)
+			}
+		}
+		b.WriteByte(']')
+	case reference:
+		g.write(b, g.rules[e.name].expr, min)
+	case sequence:
+		for _, e := range e {
+			g.write(b, e, precSequence)
+		}
+	case alternatives:
+		for i, e := range e {
+			if i > 0 {
+				b.WriteByte('|')
+			}
+			g.write(b, e, precAlternatives)
+		}
+	case repetition:
+		g.write(b, e.expr, precTerminal)
+		b.WriteByte(e.op)
+	}
+}
+
+func writeClassChar(b *bytes.Buffer, c byte) {
+	if strings.IndexByte(`\]-^[`, c) >= 0 {
+		b.WriteByte('\\')
+	}
+	b.WriteByte(c)
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebnf
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenError
+	tokenSymbol
+	tokenDefine
+	tokenLiteral
+	tokenClass
+	tokenLParen
+	tokenRParen
+	tokenStar
+	tokenPlus
+	tokenPipe
+)
+
+type token struct {
+	kind tokenKind
+	pos  position
+	text string
+
+	// ranges holds the characters of a tokenClass.
+	ranges []charRange
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenSymbol:
+		return "symbol " + strconv.Quote(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+// lexer splits a grammar into tokens, ignoring whitespace.
+type lexer struct {
+	src string
+	off int
+	pos position
+}
+
+// advance moves n bytes forward.
+func (l *lexer) advance(n int) {
+	for ; n > 0; n-- {
+		if l.src[l.off] == '\n' {
+			l.pos.line++
+			l.pos.col = 1
+		} else {
+			l.pos.col++
+		}
+		l.off++
+	}
+}
+
+func (l *lexer) errorf(pos position, format string, args ...interface{}) token {
+	return token{kind: tokenError, pos: pos, text: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) next() token {
+	for l.off < len(l.src) && isSpace(l.src[l.off]) {
+		l.advance(1)
+	}
+	if l.off >= len(l.src) {
+		return token{kind: tokenEOF, pos: l.pos}
+	}
+
+	pos := l.pos
+	rest := l.src[l.off:]
+	single := map[byte]tokenKind{
+		'(': tokenLParen,
+		')': tokenRParen,
+		'*': tokenStar,
+		'+': tokenPlus,
+		'|': tokenPipe,
+	}
+	if kind, ok := single[rest[0]]; ok {
+		l.advance(1)
+		return token{kind: kind, pos: pos, text: rest[:1]}
+	}
+
+	switch c := rest[0]; {
+	case len(rest) >= 3 && rest[:3] == "::=":
+		l.advance(3)
+		return token{kind: tokenDefine, pos: pos, text: "::="}
+	case c == '"':
+		n := 1
+		for n < len(rest) && rest[n] != '"' {
+			if rest[n] < ' ' || rest[n] > '~' {
+				return l.errorf(pos, "literals may only hold printable 7-bit ASCII characters")
+			}
+			n++
+		}
+		if n == len(rest) {
+			return l.errorf(pos, "unterminated literal")
+		}
+		if n == 1 {
+			return l.errorf(pos, "empty literal")
+		}
+		l.advance(n + 1)
+		return token{kind: tokenLiteral, pos: pos, text: rest[1:n]}
+	case c == '[':
+		return l.class(pos, rest)
+	case isSymbolStart(c):
+		n := 1
+		for n < len(rest) && isSymbolChar(rest[n]) {
+			n++
+		}
+		l.advance(n)
+		return token{kind: tokenSymbol, pos: pos, text: rest[:n]}
+	}
+	return l.errorf(pos, "unexpected character %q", rest[0])
+}
+
+// class scans the character class at the start of rest.
+func (l *lexer) class(pos position, rest string) token {
+	end := 1
+	for end < len(rest) && rest[end] != ']' {
+		if rest[end] <= ' ' || rest[end] > '~' {
+			return l.errorf(pos, "character classes may only hold printable 7-bit ASCII characters")
+		}
+		end++
+	}
+	if end == len(rest) {
+		return l.errorf(pos, "unterminated character class")
+	}
+
+	chars := rest[1:end]
+	switch {
+	case chars == "":
+		return l.errorf(pos, "empty character class")
+	case chars[0] == '^':
+		return l.errorf(pos, "negated character classes are not supported")
+	}
+
+	var ranges []charRange
+	for i := 0; i < len(chars); i++ {
+		r := charRange{chars[i], chars[i]}
+		if i+2 < len(chars) && chars[i+1] == '-' {
+			r.hi = chars[i+2]
+			if r.hi < r.lo {
+				return l.errorf(pos, "invalid character range %s", chars[i:i+3])
+			}
+			i += 2
+		}
+		ranges = append(ranges, r)
+	}
+
+	l.advance(end + 1)
+	return token{kind: tokenClass, pos: pos, text: rest[:end+1], ranges: ranges}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isSymbolStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isSymbolChar(c byte) bool {
+	return isSymbolStart(c) || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.'
+}
+
+// parser builds expressions from the tokens of lex,
+// looking ahead one token further than the current one.
+type parser struct {
+	lex  lexer
+	tok  token
+	peek token
+}
+
+func (p *parser) next() {
+	p.tok = p.peek
+	p.peek = p.lex.next()
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	if t.kind == tokenError {
+		return SyntaxError{Line: t.pos.line, Col: t.pos.col, Msg: t.text}
+	}
+	return SyntaxError{Line: t.pos.line, Col: t.pos.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// atRuleEnd reports whether the current token ends the expression of a rule,
+// which is the case at the end of input and at the start of the next rule.
+func (p *parser) atRuleEnd() bool {
+	return p.tok.kind == tokenEOF || p.tok.kind == tokenSymbol && p.peek.kind == tokenDefine
+}
+
+func (p *parser) parseAlternatives() (expression, error) {
+	first, err := p.parseSequence()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenPipe {
+		return first, nil
+	}
+
+	alts := alternatives{first}
+	for p.tok.kind == tokenPipe {
+		p.next()
+		e, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, e)
+	}
+	return alts, nil
+}
+
+func (p *parser) parseSequence() (expression, error) {
+	var seq sequence
+	for !p.atRuleEnd() && p.tok.kind != tokenPipe && p.tok.kind != tokenRParen {
+		e, err := p.parseRepetition()
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, e)
+	}
+
+	switch len(seq) {
+	case 0:
+		return nil, p.errorf(p.tok, "expected an expression but found %s", p.tok)
+	case 1:
+		return seq[0], nil
+	}
+	return seq, nil
+}
+
+func (p *parser) parseRepetition() (expression, error) {
+	e, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokenStar || p.tok.kind == tokenPlus {
+		e = repetition{expr: e, op: p.tok.text[0]}
+		p.next()
+	}
+	return e, nil
+}
+
+func (p *parser) parseTerm() (expression, error) {
+	t := p.tok
+	switch t.kind {
+	case tokenLiteral:
+		p.next()
+		return literal{text: t.text}, nil
+	case tokenClass:
+		p.next()
+		return class{ranges: t.ranges}, nil
+	case tokenSymbol:
+		p.next()
+		return reference{name: t.text, pos: t.pos}, nil
+	case tokenLParen:
+		p.next()
+		e, err := p.parseAlternatives()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenRParen {
+			return nil, p.errorf(p.tok, "expected \")\" but found %s", p.tok)
+		}
+		p.next()
+		return e, nil
+	}
+	return nil, p.errorf(t, "expected an expression but found %s", t)
+}
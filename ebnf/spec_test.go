@@ -0,0 +1,163 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ebnf
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDigestGrammar(t *testing.T) {
+	g := specGrammar(t, "../descriptor.md", "digest")
+	re, err := g.Regexp("digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the example digests of descriptor.md, skipping the truncated one
+	p, err := ioutil.ReadFile("../descriptor.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples := regexp.MustCompile("(?m)^`([^`]+)`\\s*\\|").FindAllStringSubmatch(string(p), -1)
+	if len(examples) == 0 {
+		t.Fatal("no example digests found")
+	}
+	for _, example := range examples {
+		if strings.HasSuffix(example[1], "...") {
+			continue
+		}
+		if !re.MatchString(example[1]) {
+			t.Errorf("expected example digest %s to match", example[1])
+		}
+	}
+
+	for _, invalid := range []string{
+		"sha256",
+		":6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+		"SHA256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+		"sha256+:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b",
+		"sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b/",
+	} {
+		if re.MatchString(invalid) {
+			t.Errorf("expected digest %s not to match", invalid)
+		}
+	}
+}
+
+func TestRefNameGrammar(t *testing.T) {
+	g := specGrammar(t, "../annotations.md", "ref")
+	re, err := g.Regexp("ref")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for input, match := range map[string]bool{
+		"1.0":               true,
+		"v1.0.1":            true,
+		"stable-3.4":        true,
+		"foo--bar":          true,
+		"example.com/a:b@c": true,
+		"-foo":              false,
+		"foo-":              false,
+		"foo---bar":         false,
+		"foo/":              false,
+		"foo//bar":          false,
+		"foo bar":           false,
+	} {
+		if re.MatchString(input) != match {
+			t.Errorf("expected match=%t for %q", match, input)
+		}
+	}
+}
+
+// TestConsiderationsExample checks that the example grammar of the EBNF
+// section is converted into the regular expression given after it.
+func TestConsiderationsExample(t *testing.T) {
+	blocks := codeBlocks(t, "../considerations.md")
+	for i, block := range blocks {
+		if !strings.HasPrefix(block, "path ") || i+1 == len(blocks) {
+			continue
+		}
+
+		g, err := Parse(strings.NewReader(block))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := g.Expression("path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := strings.TrimSpace(blocks[i+1]); expr != expected {
+			t.Errorf("expected %s but got %s", expected, expr)
+		}
+		return
+	}
+	t.Fatal("example grammar not found")
+}
+
+// specGrammar parses the grammar defining symbol in the markdown file name.
+func specGrammar(t *testing.T, name, symbol string) *Grammar {
+	for _, block := range codeBlocks(t, name) {
+		if !strings.Contains(block, "::=") {
+			continue
+		}
+		g, err := Parse(strings.NewReader(block))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, s := range g.Symbols() {
+			if s == symbol {
+				return g
+			}
+		}
+	}
+	t.Fatalf("%s: no grammar defining %s", name, symbol)
+	return nil
+}
+
+// codeBlocks returns the fenced code blocks of the markdown file name,
+// including those nested in lists, with their indentation removed.
+func codeBlocks(t *testing.T, name string) []string {
+	p, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		blocks []string
+		block  []string
+		indent string
+		inside bool
+	)
+	for _, line := range strings.Split(string(p), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(trimmed, "```") {
+			if inside {
+				blocks = append(blocks, strings.Join(block, "\n"))
+				block = nil
+			}
+			indent = line[:len(line)-len(trimmed)]
+			inside = !inside
+			continue
+		}
+		if inside {
+			block = append(block, strings.TrimPrefix(line, indent))
+		}
+	}
+	return blocks
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"fmt"
+	"io"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// SizeExceededError is returned by a verified reader as soon as
+// the content holds more bytes than the descriptor declares.
+type SizeExceededError struct {
+	Digest digest.Digest
+	Size   int64
+}
+
+func (e SizeExceededError) Error() string {
+	return fmt.Sprintf("content of %s exceeds the declared size %d", e.Digest, e.Size)
+}
+
+// SizeMismatchError is returned by a verified reader at the end of
+// content which holds fewer bytes than the descriptor declares.
+type SizeMismatchError struct {
+	Digest digest.Digest
+	Size   int64
+	Actual int64
+}
+
+func (e SizeMismatchError) Error() string {
+	return fmt.Sprintf("content of %s has size %d instead of %d", e.Digest, e.Actual, e.Size)
+}
+
+// DigestMismatchError is returned by a verified reader at the end of
+// content which does not match the digest of the descriptor.
+type DigestMismatchError struct {
+	Digest digest.Digest
+	Actual digest.Digest
+}
+
+func (e DigestMismatchError) Error() string {
+	return fmt.Sprintf("content of %s has digest %s", e.Digest, e.Actual)
+}
+
+// NewVerifiedReader returns a reader of the content r holds for desc.
+// Reading fails with a SizeExceededError as soon as r holds more than
+// desc.Size bytes. At the end of r, the reader returns io.EOF only if
+// r held exactly desc.Size bytes, otherwise a SizeMismatchError, and if
+// the content matches desc.Digest, otherwise a DigestMismatchError.
+// The data returned before io.EOF must not be trusted until then.
+//
+// The digest algorithm of desc must be available, which this package
+// ensures for the algorithms defined by the go-digest package.
+func NewVerifiedReader(r io.Reader, desc v1.Descriptor) (io.Reader, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return nil, err
+	}
+	if desc.Size < 0 {
+		return nil, fmt.Errorf("invalid size %d of %s", desc.Size, desc.Digest)
+	}
+	return &verifiedReader{
+		r:        r,
+		desc:     desc,
+		digester: desc.Digest.Algorithm().Digester(),
+	}, nil
+}
+
+type verifiedReader struct {
+	r        io.Reader
+	desc     v1.Descriptor
+	digester digest.Digester
+	n        int64
+	err      error
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Read at most one byte more than declared to detect oversized content.
+	// remaining+1 overflows for the largest sizes, which need no limit.
+	if remaining := v.desc.Size - v.n; remaining < int64(len(p))-1 {
+		p = p[:remaining+1]
+	}
+	n, err := v.r.Read(p)
+	if int64(n) > v.desc.Size-v.n {
+		n = int(v.desc.Size - v.n)
+		err = SizeExceededError{Digest: v.desc.Digest, Size: v.desc.Size}
+	}
+	v.digester.Hash().Write(p[:n])
+	v.n += int64(n)
+
+	switch err {
+	case nil:
+		return n, nil
+	case io.EOF:
+		err = v.verify()
+	}
+	v.err = err
+	return n, err
+}
+
+// verify checks the content read so far at the end of the content.
+func (v *verifiedReader) verify() error {
+	if v.n != v.desc.Size {
+		return SizeMismatchError{Digest: v.desc.Digest, Size: v.desc.Size, Actual: v.n}
+	}
+	if actual := v.digester.Digest(); actual != v.desc.Digest {
+		return DigestMismatchError{Digest: v.desc.Digest, Actual: actual}
+	}
+	return io.EOF
+}
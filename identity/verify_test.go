@@ -0,0 +1,121 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package identity
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestVerifiedReader(t *testing.T) {
+	content := []byte("hello, world")
+
+	for _, alg := range []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512} {
+		desc := v1.Descriptor{Digest: alg.FromBytes(content), Size: int64(len(content))}
+		other := alg.FromString("other")
+
+		for _, testcase := range []struct {
+			Name     string
+			Content  []byte
+			Desc     v1.Descriptor
+			Read     int
+			Expected error
+		}{
+			{
+				Name:    "valid",
+				Content: content,
+				Desc:    desc,
+				Read:    len(content),
+			},
+			{
+				Name:     "too long",
+				Content:  append(content, '!'),
+				Desc:     desc,
+				Read:     len(content),
+				Expected: SizeExceededError{Digest: desc.Digest, Size: desc.Size},
+			},
+			{
+				Name:     "too short",
+				Content:  content[:5],
+				Desc:     desc,
+				Read:     5,
+				Expected: SizeMismatchError{Digest: desc.Digest, Size: desc.Size, Actual: 5},
+			},
+			{
+				Name:     "digest mismatch",
+				Content:  content,
+				Desc:     v1.Descriptor{Digest: other, Size: desc.Size},
+				Read:     len(content),
+				Expected: DigestMismatchError{Digest: other, Actual: desc.Digest},
+			},
+			{
+				Name:     "maximum size",
+				Content:  content,
+				Desc:     v1.Descriptor{Digest: desc.Digest, Size: math.MaxInt64},
+				Read:     len(content),
+				Expected: SizeMismatchError{Digest: desc.Digest, Size: math.MaxInt64, Actual: desc.Size},
+			},
+			{
+				Name:     "empty",
+				Content:  nil,
+				Desc:     v1.Descriptor{Digest: alg.FromBytes(nil)},
+				Expected: nil,
+			},
+		} {
+			for _, oneByte := range []bool{false, true} {
+				var r io.Reader = bytes.NewReader(testcase.Content)
+				if oneByte {
+					r = iotest.OneByteReader(r)
+				}
+				vr, err := NewVerifiedReader(r, testcase.Desc)
+				if err != nil {
+					t.Fatalf("%s/%s: %v", alg, testcase.Name, err)
+				}
+
+				p, err := ioutil.ReadAll(vr)
+				if !reflect.DeepEqual(err, testcase.Expected) {
+					t.Errorf("%s/%s: expected error %v but got %v", alg, testcase.Name, testcase.Expected, err)
+				}
+				if len(p) != testcase.Read {
+					t.Errorf("%s/%s: expected %d bytes but got %d", alg, testcase.Name, testcase.Read, len(p))
+				}
+				// errors are sticky
+				if _, again := vr.Read(make([]byte, 1)); err != nil && again != err {
+					t.Errorf("%s/%s: expected error %v again but got %v", alg, testcase.Name, err, again)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifiedReaderInvalidDescriptor(t *testing.T) {
+	for _, desc := range []v1.Descriptor{
+		{Digest: "sha256:invalid"},
+		{Digest: "md5:d41d8cd98f00b204e9800998ecf8427e"},
+		{Digest: FromString("foo"), Size: -1},
+	} {
+		if _, err := NewVerifiedReader(bytes.NewReader(nil), desc); err == nil {
+			t.Errorf("expected an error for %+v", desc)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// maxSymlinks limits the symbolic links followed to resolve a path.
+const maxSymlinks = 255
+
+// WhiteoutFormat selects how Apply treats whiteouts.
+type WhiteoutFormat int
+
+const (
+	// WhiteoutApply removes the lower files named by whiteouts,
+	// as described in layer.md.
+	WhiteoutApply WhiteoutFormat = iota
+
+	// WhiteoutOverlay keeps the lower files and translates whiteouts
+	// for the overlay filesystem instead, for extracting every layer
+	// into a lower directory of its own: explicit whiteouts become
+	// character devices with device number 0/0 and opaque whiteouts
+	// set the trusted.overlay.opaque extended attribute of their
+	// directory to "y". It requires privileges and is linux only.
+	WhiteoutOverlay
+)
+
+// ApplyOptions configures Apply.
+type ApplyOptions struct {
+	// IgnoreOwnership leaves the owners of the files to the user running
+	// Apply. Setting owners requires privileges.
+	IgnoreOwnership bool
+
+	// Whiteouts selects how whiteouts are treated.
+	Whiteouts WhiteoutFormat
+}
+
+// Apply applies the layer read from r, with the given layer media type,
+// onto the root filesystem directory root, as described in layer.md.
+// It returns the DiffID of the layer.
+//
+// Whiteouts remove the lower files they name, an opaque whiteout all lower
+// children of its directory, wherever it appears in the layer; see
+// WhiteoutFormat for the alternative. An entry replaces an existing file,
+// unless both are directories, in which case the attributes of the
+// directory are replaced. Modes, owners,
+// modification times, extended attributes and hardlinks are restored;
+// the modification times and extended attributes of symbolic links
+// are not. Directories without an entry keep their modification times.
+//
+// Paths are resolved as if root was the root directory, so neither
+// entries nor symbolic links can refer to files outside of root.
+func Apply(root string, r io.Reader, mediaType string, opts ApplyOptions) (digest.Digest, error) {
+	r, err := decompress(r, mediaType)
+	if err != nil {
+		return "", err
+	}
+
+	digester := digest.Canonical.Digester()
+	r = io.TeeReader(r, digester.Hash())
+
+	a := &applier{
+		root:    root,
+		opts:    opts,
+		applied: map[string]bool{},
+		added:   map[string]bool{},
+		mtimes:  map[string]time.Time{},
+	}
+	if err := a.apply(tar.NewReader(r)); err != nil {
+		return "", err
+	}
+	// the DiffID covers the padding after the end of the archive
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return "", errors.Wrap(err, "unable to read the layer")
+	}
+	return digester.Digest(), nil
+}
+
+// decompress returns the tar archive of the layer r
+// with the given layer media type.
+func decompress(r io.Reader, mediaType string) (io.Reader, error) {
+	switch mediaType {
+	case v1.MediaTypeImageLayer, v1.MediaTypeImageLayerNonDistributable:
+		return r, nil
+	case v1.MediaTypeImageLayerGzip, v1.MediaTypeImageLayerNonDistributableGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "layer is not gzip compressed")
+		}
+		return gz, nil
+	}
+	return nil, errors.Errorf("unsupported layer media type %q", mediaType)
+}
+
+type applier struct {
+	root string
+	opts ApplyOptions
+
+	// applied holds the paths of the entries applied so far and added
+	// also their parent directories, which whiteouts of the layer do
+	// not remove.
+	applied, added map[string]bool
+
+	// dirs holds the headers of the directories applied so far, whose
+	// modification times are restored once their children are applied.
+	dirs []*tar.Header
+
+	// mtimes holds the modification times of the existing directories
+	// whose children were changed, which are restored as well. They are
+	// keyed by the resolved paths of the directories within the root
+	// directory, which are resolved again when they are restored, as
+	// later entries may have replaced parents with symbolic links.
+	mtimes map[string]time.Time
+}
+
+func (a *applier) apply(tr *tar.Reader) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to read the layer tar archive")
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			// pax global headers hold no file
+			continue
+		}
+
+		name, err := entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			// the root directory keeps its attributes
+			continue
+		}
+
+		dir, base := path.Split(name)
+		dir = path.Clean(dir)
+		overlay := a.opts.Whiteouts == WhiteoutOverlay
+		switch {
+		case base == WhiteoutOpaqueDir && overlay:
+			err = a.overlayOpaque(dir)
+		case base == WhiteoutOpaqueDir:
+			err = a.removeLower(dir)
+		case strings.HasPrefix(base, WhiteoutMetaPrefix):
+			err = errors.New("unknown whiteout meta entry")
+		case strings.HasPrefix(base, WhiteoutPrefix) && overlay:
+			err = a.overlayWhiteout(path.Join(dir, strings.TrimPrefix(base, WhiteoutPrefix)))
+		case strings.HasPrefix(base, WhiteoutPrefix):
+			err = a.whiteout(path.Join(dir, strings.TrimPrefix(base, WhiteoutPrefix)))
+		default:
+			err = a.applyEntry(name, hdr, tr)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "layer entry %q", hdr.Name)
+		}
+	}
+
+	for name, mtime := range a.mtimes {
+		p, err := a.path(name)
+		if err != nil {
+			return err
+		}
+		// a later entry may have replaced the directory
+		if fi, err := os.Lstat(p); err != nil || !fi.IsDir() {
+			continue
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			return errors.Wrap(err, "unable to restore a modification time")
+		}
+	}
+	for i := len(a.dirs) - 1; i >= 0; i-- {
+		hdr := a.dirs[i]
+		p, err := a.path(hdr.Name)
+		if err != nil {
+			return err
+		}
+		// a later entry may have replaced the directory
+		if fi, err := os.Lstat(p); err != nil || !fi.IsDir() {
+			continue
+		}
+		if err := os.Chtimes(p, hdr.ModTime, hdr.ModTime); err != nil {
+			return errors.Wrapf(err, "layer entry %q", hdr.Name)
+		}
+	}
+	return nil
+}
+
+// entryPath returns the slash-separated path of a tar entry name
+// relative to the root directory. Absolute names are relative to it.
+func entryPath(name string) (string, error) {
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", errors.Errorf("layer entry %q escapes the root filesystem", name)
+	}
+	return strings.TrimPrefix(path.Clean("/"+clean), "/"), nil
+}
+
+// markApplied records that name was applied from the layer.
+func (a *applier) markApplied(name string) {
+	a.applied[name] = true
+	for ; name != "." && name != "/" && name != ""; name = path.Dir(name) {
+		a.added[name] = true
+	}
+}
+
+// whiteout removes the lower file name.
+func (a *applier) whiteout(name string) error {
+	p, err := a.path(name)
+	if err != nil {
+		return err
+	}
+	if a.added[name] {
+		// only the lower children of a directory of the layer are hidden
+		if fi, err := os.Lstat(p); err != nil || !fi.IsDir() {
+			return err
+		}
+		return a.removeLower(name)
+	}
+	if err := a.preserveMtime(path.Dir(name)); err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// overlayWhiteout creates an overlay whiteout for the lower file name.
+func (a *applier) overlayWhiteout(name string) error {
+	if err := a.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	p, err := a.path(name)
+	if err != nil {
+		return err
+	}
+	if a.added[name] {
+		// only the lower directories are hidden
+		if fi, err := os.Lstat(p); err != nil || !fi.IsDir() {
+			return err
+		}
+		return overlayOpaque(p)
+	}
+	if err := a.preserveMtime(path.Dir(name)); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(p); err != nil {
+		return err
+	}
+	return overlayWhiteout(p)
+}
+
+// overlayOpaque makes the directory dir an opaque overlay directory.
+func (a *applier) overlayOpaque(dir string) error {
+	if err := a.mkdirAll(dir); err != nil {
+		return err
+	}
+	p, err := a.path(dir)
+	if err != nil {
+		return err
+	}
+	return overlayOpaque(p)
+}
+
+// preserveMtime records the modification time of the existing directory
+// dir before its children are changed.
+func (a *applier) preserveMtime(dir string) error {
+	resolved, err := a.resolve(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := a.mtimes[resolved]; ok {
+		return nil
+	}
+	fi, err := os.Lstat(filepath.Join(a.root, filepath.FromSlash(resolved)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		a.mtimes[resolved] = fi.ModTime()
+	}
+	return nil
+}
+
+// removeLower removes the children of the directory dir,
+// except the ones applied from the layer.
+func (a *applier) removeLower(dir string) error {
+	p, err := a.path(dir)
+	if err != nil {
+		return err
+	}
+	if dir == "." {
+		dir = ""
+	}
+	names, err := readDirNames(p)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.preserveMtime(dir); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		child := path.Join(dir, name)
+		cp := filepath.Join(p, name)
+		if !a.added[child] {
+			if err := os.RemoveAll(cp); err != nil {
+				return err
+			}
+			continue
+		}
+		fi, err := os.Lstat(cp)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if err := a.removeLower(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyEntry creates the file name from hdr, replacing an existing one.
+func (a *applier) applyEntry(name string, hdr *tar.Header, r io.Reader) error {
+	p, err := a.path(name)
+	if err != nil {
+		return err
+	}
+	if err := a.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	if err := a.preserveMtime(path.Dir(name)); err != nil {
+		return err
+	}
+
+	fi, err := os.Lstat(p)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case fi.IsDir() && hdr.Typeflag == tar.TypeDir:
+	default:
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+
+	mode := os.FileMode(hdr.Mode).Perm()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if fi == nil || !fi.IsDir() {
+			err = os.Mkdir(p, mode)
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		err = writeFile(p, r, mode)
+	case tar.TypeSymlink:
+		err = os.Symlink(hdr.Linkname, p)
+	case tar.TypeLink:
+		var target string
+		if target, err = entryPath(hdr.Linkname); err != nil {
+			return err
+		}
+		var tp string
+		if tp, err = a.path(target); err != nil {
+			return err
+		}
+		if fi, err := os.Lstat(tp); err != nil || fi.IsDir() {
+			return errors.Errorf("hardlink target %q is not a file", hdr.Linkname)
+		}
+		err = os.Link(tp, p)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		err = mknod(p, hdr)
+	default:
+		return errors.Errorf("unsupported entry type %q", hdr.Typeflag)
+	}
+	if err != nil {
+		return err
+	}
+	a.markApplied(name)
+
+	if hdr.Typeflag == tar.TypeLink {
+		return nil
+	}
+	if err := a.setAttributes(p, hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		h := *hdr
+		h.Name = name
+		a.dirs = append(a.dirs, &h)
+	}
+	return nil
+}
+
+// setAttributes restores the attributes of hdr on the file at p.
+func (a *applier) setAttributes(p string, hdr *tar.Header) error {
+	if !a.opts.IgnoreOwnership {
+		if err := os.Lchown(p, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	for key, value := range hdr.Xattrs {
+		if err := setxattr(p, key, value); err != nil {
+			return err
+		}
+	}
+	// after chown, which clears the setuid and setgid bits
+	if err := os.Chmod(p, tarMode(hdr.Mode)); err != nil {
+		return err
+	}
+	return os.Chtimes(p, hdr.ModTime, hdr.ModTime)
+}
+
+// tarMode converts the mode bits of a tar header to an os.FileMode.
+func tarMode(mode int64) os.FileMode {
+	m := os.FileMode(mode).Perm()
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+func writeFile(p string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mkdirAll creates the directory dir and its missing parents.
+func (a *applier) mkdirAll(dir string) error {
+	resolved, err := a.resolve(dir)
+	if err != nil {
+		return err
+	}
+	// the existing parts of the resolved path are no symbolic links
+	return os.MkdirAll(filepath.Join(a.root, filepath.FromSlash(resolved)), 0755)
+}
+
+// path returns the path of the file name below the root directory.
+// Symbolic links in the parent directories of name are followed as if
+// root was the root directory; name itself is not followed.
+func (a *applier) path(name string) (string, error) {
+	dir, base := path.Split(path.Clean(name))
+	if base == "." || base == "/" {
+		return a.root, nil
+	}
+	resolved, err := a.resolve(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(a.root, filepath.FromSlash(resolved), base), nil
+}
+
+// resolve follows the symbolic links of the slash-separated path name
+// within the root directory and returns the resolved path.
+func (a *applier) resolve(name string) (string, error) {
+	components := strings.Split(name, "/")
+	resolved := ""
+	links := 0
+	for len(components) > 0 {
+		c := components[0]
+		components = components[1:]
+
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if resolved != "" {
+				resolved = path.Dir(resolved)
+				if resolved == "." {
+					resolved = ""
+				}
+			}
+			continue
+		}
+
+		next := path.Join(resolved, c)
+		p := filepath.Join(a.root, filepath.FromSlash(next))
+		fi, err := os.Lstat(p)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", errors.Errorf("too many symbolic links in %q", name)
+		}
+		target, err := os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = ""
+		}
+		components = append(strings.Split(target, "/"), components...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package layer
+
+import (
+	"archive/tar"
+	"syscall"
+)
+
+// mknod creates the device or FIFO described by hdr at path.
+func mknod(path string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= syscall.S_IFCHR
+	case tar.TypeBlock:
+		mode |= syscall.S_IFBLK
+	case tar.TypeFifo:
+		mode |= syscall.S_IFIFO
+	}
+	return syscall.Mknod(path, mode, mkdev(hdr.Devmajor, hdr.Devminor))
+}
+
+// mkdev encodes a device number as the Linux kernel does.
+func mkdev(major, minor int64) int {
+	return int(minor&0xff | (major&0xfff)<<8 | (minor&^0xff)<<12 | (major&^0xfff)<<32)
+}
+
+// setxattr sets the extended attribute name of the file at path.
+func setxattr(path, name, value string) error {
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
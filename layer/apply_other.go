@@ -0,0 +1,34 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package layer
+
+import (
+	"archive/tar"
+
+	"github.com/pkg/errors"
+)
+
+// mknod fails, devices and FIFOs are not supported on this platform.
+func mknod(path string, hdr *tar.Header) error {
+	return errors.Errorf("entry type %q is not supported on this platform", hdr.Typeflag)
+}
+
+// setxattr fails, extended attributes are not supported on this platform.
+func setxattr(path, name, value string) error {
+	return errors.New("extended attributes are not supported on this platform")
+}
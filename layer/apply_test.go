@@ -0,0 +1,365 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// buildLayer returns a tar archive with entries described as for makeTree,
+// and whiteouts as plain names.
+func buildLayer(t *testing.T, specs ...string) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, spec := range specs {
+		hdr := &tar.Header{Name: spec, Typeflag: tar.TypeReg, Mode: 0644, ModTime: testTime}
+		var content string
+		switch {
+		case strings.Contains(spec, "->"):
+			parts := strings.SplitN(spec, "->", 2)
+			hdr.Name, hdr.Typeflag, hdr.Linkname = parts[0], tar.TypeSymlink, parts[1]
+		case strings.Contains(spec, "=>"):
+			parts := strings.SplitN(spec, "=>", 2)
+			hdr.Name, hdr.Typeflag, hdr.Linkname = parts[0], tar.TypeLink, parts[1]
+		case strings.HasSuffix(spec, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		default:
+			parts := strings.SplitN(spec+"=", "=", 3)
+			hdr.Name, content = parts[0], parts[1]
+			hdr.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// listTree lists the files below root as "dir/", "name->target"
+// and "name=content".
+func listTree(t *testing.T, root string) []string {
+	var files []string
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case fi.IsDir():
+			files = append(files, rel+"/")
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel+"->"+link)
+		default:
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel+"="+string(content))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestApplyDiff(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("hardlinks are only detected on linux")
+	}
+
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "base")
+	makeTree(t, base, "bin/", "bin/sh=sh", "bin/bash=>bin/sh", "etc/", "etc/hosts=a", "lib/", "lib/a=a", "lib/b=b", "tmp/", "usr/")
+	target := filepath.Join(dir, "target")
+	makeTree(t, target, "bin/", "bin/sh=sh2", "bin/bash=>bin/sh", "etc/", "etc/hosts/", "etc/hosts/a=a", "lib/", "tmp=tmp", "usr/", "usr/lib->../lib")
+	if err := os.Chmod(filepath.Join(target, "bin", "sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(target, "bin", "sh"), testTime, testTime); err != nil {
+		t.Fatal(err)
+	}
+
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, diff := range [][2]string{{"", base}, {base, target}} {
+		buf := &bytes.Buffer{}
+		diffID, err := layer.Diff(buf, diff[0], diff[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied, err := layer.Apply(rootfs, buf, v1.MediaTypeImageLayer, layer.ApplyOptions{IgnoreOwnership: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != diffID {
+			t.Errorf("expected DiffID %s but got %s", diffID, applied)
+		}
+
+		changes, err := layer.Changes(rootfs, diff[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("expected the applied root filesystem to equal %s but got %v", diff[1], changes)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		lower    []string
+		layer    []string
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "whiteout",
+			lower:    []string{"etc/", "etc/my-app-config=a", "etc/other=b"},
+			layer:    []string{"etc/.wh.my-app-config", "etc/.wh.missing"},
+			expected: []string{"etc/", "etc/other=b"},
+		},
+		{
+			name:     "opaque whiteout applies first",
+			lower:    []string{"a/", "a/b/", "a/b/c/", "a/b/c/bar=bar", "a/x=x"},
+			layer:    []string{"a/", "a/b/", "a/b/c/", "a/b/c/foo=foo", "a/.wh..wh..opq"},
+			expected: []string{"a/", "a/b/", "a/b/c/", "a/b/c/foo=foo"},
+		},
+		{
+			name:     "whiteout only hides lower files",
+			lower:    []string{"a=a", "d/", "d/lower=lower"},
+			layer:    []string{"a=new", ".wh.a", "d/", "d/upper=upper", ".wh.d"},
+			expected: []string{"a=new", "d/", "d/upper=upper"},
+		},
+		{
+			name:     "file replaces directory",
+			lower:    []string{"a/", "a/b=b"},
+			layer:    []string{"a=a"},
+			expected: []string{"a=a"},
+		},
+		{
+			name:     "directory replaces file",
+			lower:    []string{"a=a"},
+			layer:    []string{"a/", "a/b=b"},
+			expected: []string{"a/", "a/b=b"},
+		},
+		{
+			name:     "directory keeps its children",
+			lower:    []string{"a/", "a/b=b"},
+			layer:    []string{"a/", "a/c=c"},
+			expected: []string{"a/", "a/b=b", "a/c=c"},
+		},
+		{
+			name:     "missing parents",
+			layer:    []string{"a/b/c=c"},
+			expected: []string{"a/", "a/b/", "a/b/c=c"},
+		},
+		{
+			name:     "hardlink",
+			layer:    []string{"a=a", "b=>a", "c=>/a"},
+			expected: []string{"a=a", "b=a", "c=a"},
+		},
+		{
+			name:     "relative symlink escape",
+			lower:    []string{"evil->../../../.."},
+			layer:    []string{"evil/etc/passwd=root"},
+			expected: []string{"etc/", "etc/passwd=root", "evil->../../../.."},
+		},
+		{
+			name:     "absolute symlink escape",
+			lower:    []string{"lib/", "usr/", "usr/lib->/lib", "evil->/"},
+			layer:    []string{"usr/lib/x=x", "evil/y=y", "h=>evil/y"},
+			expected: []string{"evil->/", "h=y", "lib/", "lib/x=x", "usr/", "usr/lib->/lib", "y=y"},
+		},
+		{
+			name:  "path escape",
+			layer: []string{"../x=x"},
+			err:   true,
+		},
+		{
+			name:  "hardlink to a directory",
+			layer: []string{"a/", "b=>a"},
+			err:   true,
+		},
+		{
+			name:  "symlink loop",
+			lower: []string{"a->b", "b->a"},
+			layer: []string{"a/x=x"},
+			err:   true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "layer-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			rootfs := filepath.Join(dir, "a", "b", "rootfs")
+			makeTree(t, rootfs, tt.lower...)
+
+			_, err = layer.Apply(rootfs, bytes.NewReader(buildLayer(t, tt.layer...)), v1.MediaTypeImageLayer, layer.ApplyOptions{IgnoreOwnership: true})
+			if tt.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if files := listTree(t, dir); len(files) < 3 || files[2] != "a/b/rootfs/" {
+				t.Errorf("files were created outside of the root filesystem: %q", files)
+			}
+			if tt.err {
+				return
+			}
+			if files := listTree(t, rootfs); !reflect.DeepEqual(files, tt.expected) {
+				t.Errorf("expected %q but got %q", tt.expected, files)
+			}
+		})
+	}
+}
+
+func TestApplyGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := buildLayer(t, "a=a")
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mediaType := range []string{v1.MediaTypeImageLayerGzip, v1.MediaTypeImageLayerNonDistributableGzip} {
+		diffID, err := layer.Apply(dir, bytes.NewReader(buf.Bytes()), mediaType, layer.ApplyOptions{IgnoreOwnership: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := digest.FromBytes(p); diffID != expected {
+			t.Errorf("expected DiffID %s but got %s", expected, diffID)
+		}
+	}
+	if files := listTree(t, dir); !reflect.DeepEqual(files, []string{"a=a"}) {
+		t.Errorf("unexpected files %q", files)
+	}
+
+	if _, err := layer.Apply(dir, bytes.NewReader(p), "application/octet-stream", layer.ApplyOptions{}); err == nil {
+		t.Error("expected an error for an unknown media type")
+	}
+}
+
+func TestApplyGlobalHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// as written by git archive
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123456789abcdef"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1, ModTime: testTime}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := layer.Apply(dir, buf, v1.MediaTypeImageLayer, layer.ApplyOptions{IgnoreOwnership: true}); err != nil {
+		t.Fatal(err)
+	}
+	if files := listTree(t, dir); !reflect.DeepEqual(files, []string{"a=a"}) {
+		t.Errorf("unexpected files %q", files)
+	}
+}
+
+func TestApplyMtimeOutsideRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root, outside := filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	makeTree(t, root, "a/", "a/b/")
+	makeTree(t, outside, "b/")
+	mtime := testTime.Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(outside, "b"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	// the modification time of a/b is restored after a is replaced
+	p := buildLayer(t, "a/b/c=c", "a->"+outside)
+	if _, err := layer.Apply(root, bytes.NewReader(p), v1.MediaTypeImageLayer, layer.ApplyOptions{IgnoreOwnership: true}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(outside, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("the modification time outside of the root directory was changed to %v", fi.ModTime())
+	}
+}
@@ -0,0 +1,550 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind int
+
+// The kinds of changes, see layer.md.
+const (
+	Added ChangeKind = iota
+	Modified
+	Deleted
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "Added"
+	case Modified:
+		return "Modified"
+	case Deleted:
+		return "Deleted"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a change between two root filesystems.
+type Change struct {
+	Kind ChangeKind
+
+	// Path is the slash-separated path of the changed file,
+	// relative to the root filesystems.
+	Path string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: /%s", c.Kind, c.Path)
+}
+
+// sysStat holds the platform specific attributes of a file.
+type sysStat struct {
+	uid, gid     int
+	dev, ino     uint64
+	nlink        uint64
+	major, minor int64
+}
+
+// entry is a file of the target root filesystem or a deletion,
+// in the order of the changeset.
+type entry struct {
+	Change
+	fi      os.FileInfo
+	changed bool
+
+	// whiteout is the name of the whiteout file of a deletion.
+	whiteout string
+}
+
+type differ struct {
+	base, target string
+
+	// overlay is true if target is the upper directory
+	// of an overlay filesystem, see DiffOverlay.
+	overlay bool
+
+	// baseLinks and targetLinks map the paths of hardlinked files to the
+	// first path of the same file, in the order of the walk.
+	baseLinks, targetLinks map[string]string
+
+	entries []entry
+}
+
+// Changes compares the root filesystem directory target with the root
+// filesystem directory base it was derived from, as described in layer.md,
+// and returns the changes in the order of a changeset. If base is empty,
+// every file of target is added.
+//
+// Files are compared by type, mode, ownership, modification time (except
+// for symbolic links), extended attributes, symlink target, device number,
+// hardlinks and content. Only the attributes of directories are compared, changes to
+// their children are reported separately. The root directory itself is
+// never reported.
+func Changes(base, target string) ([]Change, error) {
+	d, err := diff(base, target, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, e := range d.entries {
+		if e.changed {
+			changes = append(changes, e.Change)
+		}
+	}
+	return changes, nil
+}
+
+// Diff writes the changeset between the root filesystem directories base
+// and target, see Changes, to w as an uncompressed layer tar archive.
+// It returns the DiffID of the layer, the digest of the archive.
+//
+// Deleted files are written as explicit whiteouts. A directory whose
+// children in base are all deleted is written with a single opaque
+// whiteout instead, unless it had only one child. Children replaced by
+// new ones of the same name are not deleted but modified.
+// Hardlinks between files of target are preserved; the first path of a
+// hardlinked file is written whenever another path of it is.
+// Sockets cannot be represented in tar archives and are skipped.
+func Diff(w io.Writer, base, target string) (digest.Digest, error) {
+	d, err := diff(base, target, false)
+	if err != nil {
+		return "", err
+	}
+	return d.writeLayer(w)
+}
+
+// DiffOverlay writes the changeset held by the upper directory of an
+// overlay filesystem to w as an uncompressed layer tar archive, and
+// returns the DiffID of the layer. It is the reverse of applying a layer
+// with WhiteoutOverlay.
+//
+// Every file of upper is added. Character devices with device number
+// 0/0 are written as explicit whiteouts, and directories with the
+// trusted.overlay.opaque extended attribute set to "y" with an opaque
+// whiteout. The trusted.overlay extended attributes are not written.
+// Overlay whiteouts are only detected on linux.
+func DiffOverlay(w io.Writer, upper string) (digest.Digest, error) {
+	d, err := diff("", upper, true)
+	if err != nil {
+		return "", err
+	}
+	return d.writeLayer(w)
+}
+
+// writeLayer writes the changed entries to w as a layer tar archive.
+func (d *differ) writeLayer(w io.Writer) (digest.Digest, error) {
+	// A hardlink entry refers to an earlier entry of the same archive.
+	indexes := map[string]int{}
+	for i, e := range d.entries {
+		if e.Kind != Deleted {
+			indexes[e.Path] = i
+		}
+	}
+	for _, e := range d.entries {
+		if first, ok := d.targetLinks[e.Path]; ok && e.changed && e.Kind != Deleted {
+			d.entries[indexes[first]].changed = true
+		}
+	}
+
+	digester := digest.Canonical.Digester()
+	tw := tar.NewWriter(io.MultiWriter(w, digester.Hash()))
+	for _, e := range d.entries {
+		if !e.changed {
+			continue
+		}
+		if err := d.write(tw, e); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", errors.Wrap(err, "unable to write the layer")
+	}
+	return digester.Digest(), nil
+}
+
+func diff(base, target string, overlay bool) (*differ, error) {
+	d := &differ{
+		base:    base,
+		target:  target,
+		overlay: overlay,
+	}
+
+	var err error
+	if d.targetLinks, err = hardlinks(target); err != nil {
+		return nil, err
+	}
+	if base != "" {
+		if d.baseLinks, err = hardlinks(base); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.diffDir("", base != ""); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// hardlinks returns the hardlinks below root, as described in layer.md.
+func hardlinks(root string) (map[string]string, error) {
+	type inode struct{ dev, ino uint64 }
+	firsts := map[inode]string{}
+	links := map[string]string{}
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		st := stat(fi)
+		if st.nlink <= 1 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		key := inode{st.dev, st.ino}
+		if first, ok := firsts[key]; ok {
+			links[rel] = first
+		} else {
+			firsts[key] = rel
+		}
+		return nil
+	})
+	return links, errors.Wrapf(err, "unable to read root filesystem %s", root)
+}
+
+// diffDir compares the directory rel of target with the one of base.
+// inBase is false if rel is not a directory in base.
+func (d *differ) diffDir(rel string, inBase bool) error {
+	names, err := readDirNames(d.join(d.target, rel))
+	if err != nil {
+		return err
+	}
+
+	if inBase {
+		baseNames, err := readDirNames(d.join(d.base, rel))
+		if err != nil {
+			return err
+		}
+		present := map[string]bool{}
+		for _, name := range names {
+			present[name] = true
+		}
+		var deleted []string
+		for _, name := range baseNames {
+			if !present[name] {
+				deleted = append(deleted, name)
+			}
+		}
+
+		// layer.md prefers explicit whiteouts, so an opaque whiteout is
+		// only used if it is shorter.
+		opaque := len(deleted) > 1 && len(deleted) == len(baseNames)
+		for i, name := range deleted {
+			e := entry{
+				Change:   Change{Kind: Deleted, Path: path.Join(rel, name)},
+				changed:  true,
+				whiteout: path.Join(rel, WhiteoutPrefix+name),
+			}
+			if opaque {
+				// write the opaque whiteout once, report every deletion
+				e.whiteout = ""
+				if i == 0 {
+					e.whiteout = path.Join(rel, WhiteoutOpaqueDir)
+				}
+			}
+			d.entries = append(d.entries, e)
+		}
+	}
+
+	if d.overlay {
+		if names, err = d.overlayWhiteouts(rel, names); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		p := path.Join(rel, name)
+		if strings.HasPrefix(name, WhiteoutPrefix) {
+			return errors.Errorf("root filesystem %s: %s cannot be represented in a layer", d.target, p)
+		}
+
+		fi, err := os.Lstat(d.join(d.target, p))
+		if err != nil {
+			return errors.Wrapf(err, "unable to read root filesystem %s", d.target)
+		}
+
+		var baseFi os.FileInfo
+		if inBase {
+			baseFi, err = os.Lstat(d.join(d.base, p))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "unable to read root filesystem %s", d.base)
+			}
+		}
+
+		e := entry{Change: Change{Kind: Added, Path: p}, fi: fi, changed: true}
+		if baseFi != nil {
+			e.Kind = Modified
+			if e.changed, err = d.changed(p, baseFi, fi); err != nil {
+				return err
+			}
+		}
+		d.entries = append(d.entries, e)
+
+		if fi.IsDir() {
+			if err := d.diffDir(p, baseFi != nil && baseFi.IsDir()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// overlayWhiteouts adds the whiteouts of the overlay upper directory rel
+// to the changeset and returns the names of its other entries.
+func (d *differ) overlayWhiteouts(rel string, names []string) ([]string, error) {
+	dir := d.join(d.target, rel)
+	opaque, err := isOverlayOpaque(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read overlay upper directory %s", d.target)
+	}
+	if opaque {
+		d.entries = append(d.entries, entry{
+			Change:   Change{Kind: Deleted, Path: rel},
+			changed:  true,
+			whiteout: path.Join(rel, WhiteoutOpaqueDir),
+		})
+	}
+
+	var others []string
+	for _, name := range names {
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read overlay upper directory %s", d.target)
+		}
+		if !isOverlayWhiteout(fi) {
+			others = append(others, name)
+			continue
+		}
+		d.entries = append(d.entries, entry{
+			Change:   Change{Kind: Deleted, Path: path.Join(rel, name)},
+			changed:  true,
+			whiteout: path.Join(rel, WhiteoutPrefix+name),
+		})
+	}
+	return others, nil
+}
+
+// changed reports whether the file p of base differs from the one of target.
+func (d *differ) changed(p string, baseFi, fi os.FileInfo) (bool, error) {
+	if baseFi.Mode() != fi.Mode() {
+		return true, nil
+	}
+	// The modification times of symbolic links cannot be set portably,
+	// so copies of a root filesystem rarely preserve them.
+	if fi.Mode()&os.ModeSymlink == 0 && !baseFi.ModTime().Equal(fi.ModTime()) {
+		return true, nil
+	}
+	baseSt, st := stat(baseFi), stat(fi)
+	if baseSt.uid != st.uid || baseSt.gid != st.gid {
+		return true, nil
+	}
+
+	baseAttrs, err := xattrs(d.join(d.base, p))
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to read root filesystem %s", d.base)
+	}
+	attrs, err := xattrs(d.join(d.target, p))
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to read root filesystem %s", d.target)
+	}
+	if len(baseAttrs) != len(attrs) || len(attrs) > 0 && !reflect.DeepEqual(baseAttrs, attrs) {
+		return true, nil
+	}
+
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		return false, nil
+	case mode&os.ModeSymlink != 0:
+		baseLink, err := os.Readlink(d.join(d.base, p))
+		if err != nil {
+			return false, err
+		}
+		link, err := os.Readlink(d.join(d.target, p))
+		if err != nil {
+			return false, err
+		}
+		return baseLink != link, nil
+	case mode&os.ModeDevice != 0:
+		return baseSt.major != st.major || baseSt.minor != st.minor, nil
+	case mode.IsRegular():
+		if d.baseLinks[p] != d.targetLinks[p] || baseFi.Size() != fi.Size() {
+			return true, nil
+		}
+		same, err := sameContent(d.join(d.base, p), d.join(d.target, p))
+		return !same, err
+	}
+	return false, nil
+}
+
+// sameContent reports whether the files a and b have the same content.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, len(bufA))
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
+		}
+	}
+}
+
+// write writes the changeset entry of e to tw.
+func (d *differ) write(tw *tar.Writer, e entry) error {
+	if e.Kind == Deleted {
+		if e.whiteout == "" {
+			return nil
+		}
+		return tw.WriteHeader(&tar.Header{
+			Name:     e.whiteout,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			ModTime:  time.Unix(0, 0),
+		})
+	}
+	if e.fi.Mode()&os.ModeSocket != 0 {
+		return nil
+	}
+
+	src := d.join(d.target, e.Path)
+	var link string
+	if e.fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(src); err != nil {
+			return errors.Wrapf(err, "unable to read root filesystem %s", d.target)
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(e.fi, link)
+	if err != nil {
+		return errors.Wrapf(err, "root filesystem %s: %s", d.target, e.Path)
+	}
+	st := stat(e.fi)
+	hdr.Name = e.Path
+	hdr.Uid, hdr.Gid = st.uid, st.gid
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	if e.fi.IsDir() {
+		hdr.Name += "/"
+	}
+	if e.fi.Mode()&os.ModeDevice != 0 {
+		hdr.Devmajor, hdr.Devminor = st.major, st.minor
+	}
+	if first, ok := d.targetLinks[e.Path]; ok && e.fi.Mode().IsRegular() {
+		hdr.Typeflag = tar.TypeLink
+		hdr.Linkname = first
+		hdr.Size = 0
+	}
+	if hdr.Xattrs, err = xattrs(src); err != nil {
+		return errors.Wrapf(err, "unable to read root filesystem %s", d.target)
+	}
+	if d.overlay {
+		for key := range hdr.Xattrs {
+			if strings.HasPrefix(key, overlayXattrPrefix) {
+				delete(hdr.Xattrs, key)
+			}
+		}
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "unable to write %s to the layer", e.Path)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read root filesystem %s", d.target)
+	}
+	defer f.Close()
+	if _, err := io.CopyN(tw, f, hdr.Size); err != nil {
+		return errors.Wrapf(err, "unable to write %s to the layer", e.Path)
+	}
+	return nil
+}
+
+// join returns the native path of the slash-separated path rel below root.
+func (d *differ) join(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+// readDirNames returns the sorted names of the entries of the directory dir.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read root filesystem")
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read root filesystem")
+	}
+	sort.Strings(names)
+	return names, nil
+}
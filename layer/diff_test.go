@@ -0,0 +1,249 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/schema"
+)
+
+var testTime = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// makeTree creates the files described by specs below root:
+// "dir/" is a directory, "name->target" a symbolic link,
+// "name=>first" a hardlink to first and "name=content" a regular file.
+// All files get the modification time testTime.
+func makeTree(t *testing.T, root string, specs ...string) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, spec := range specs {
+		var err error
+		switch {
+		case strings.Contains(spec, "->"):
+			parts := strings.SplitN(spec, "->", 2)
+			err = os.Symlink(parts[1], filepath.Join(root, parts[0]))
+		case strings.Contains(spec, "=>"):
+			parts := strings.SplitN(spec, "=>", 2)
+			err = os.Link(filepath.Join(root, parts[1]), filepath.Join(root, parts[0]))
+		case strings.HasSuffix(spec, "/"):
+			err = os.MkdirAll(filepath.Join(root, spec), 0755)
+		default:
+			parts := strings.SplitN(spec+"=", "=", 3)
+			err = ioutil.WriteFile(filepath.Join(root, parts[0]), []byte(parts[1]), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chtimes(p, testTime, testTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tarEntries lists the entries of the tar archive p as "name" for regular
+// files and directories, "name->target" for symbolic links and
+// "name=>target" for hardlinks.
+func tarEntries(t *testing.T, p []byte) []string {
+	var entries []string
+	tr := tar.NewReader(bytes.NewReader(p))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			entries = append(entries, hdr.Name+"->"+hdr.Linkname)
+		case tar.TypeLink:
+			entries = append(entries, hdr.Name+"=>"+hdr.Linkname)
+		default:
+			entries = append(entries, hdr.Name)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("hardlinks are only detected on linux")
+	}
+
+	for _, tt := range []struct {
+		name    string
+		base    []string
+		target  []string
+		changes []string
+		entries []string
+	}{
+		{
+			name:    "initial root filesystem",
+			base:    nil,
+			target:  []string{"etc/", "etc/my-app-config=a", "bin/", "bin/my-app-binary=b", "bin/my-app-tools=c"},
+			changes: []string{"Added: /bin", "Added: /bin/my-app-binary", "Added: /bin/my-app-tools", "Added: /etc", "Added: /etc/my-app-config"},
+			entries: []string{"bin/", "bin/my-app-binary", "bin/my-app-tools", "etc/", "etc/my-app-config"},
+		},
+		{
+			name:    "layer.md example",
+			base:    []string{"etc/", "etc/my-app-config=a", "bin/", "bin/my-app-binary=b", "bin/my-app-tools=c"},
+			target:  []string{"etc/", "etc/my-app.d/", "etc/my-app.d/default.cfg=d", "bin/", "bin/my-app-binary=b", "bin/my-app-tools=C"},
+			changes: []string{"Modified: /bin/my-app-tools", "Deleted: /etc/my-app-config", "Added: /etc/my-app.d", "Added: /etc/my-app.d/default.cfg"},
+			entries: []string{"bin/my-app-tools", "etc/.wh.my-app-config", "etc/my-app.d/", "etc/my-app.d/default.cfg"},
+		},
+		{
+			name:    "replaced directory",
+			base:    []string{"a/", "a/b/", "a/b/c/", "a/b/c/bar=bar", "a/b/c/baz=baz", "a/d=d"},
+			target:  []string{"a/", "a/b/", "a/b/c/", "a/b/c/foo=foo", "a/d=d"},
+			changes: []string{"Deleted: /a/b/c/bar", "Deleted: /a/b/c/baz", "Added: /a/b/c/foo"},
+			entries: []string{"a/b/c/.wh..wh..opq", "a/b/c/foo"},
+		},
+		{
+			name:    "deleted directory",
+			base:    []string{"a/", "a/b/", "a/b/c=c", "a/d=d"},
+			target:  []string{"a/", "a/d=d"},
+			changes: []string{"Deleted: /a/b"},
+			entries: []string{"a/.wh.b"},
+		},
+		{
+			name:    "changed type",
+			base:    []string{"a=a", "b/", "b/c=c", "l->a"},
+			target:  []string{"a/", "a/c=c", "b=b", "l->b"},
+			changes: []string{"Modified: /a", "Added: /a/c", "Modified: /b", "Modified: /l"},
+			entries: []string{"a/", "a/c", "b", "l->b"},
+		},
+		{
+			name:    "new hardlink to an unchanged file",
+			base:    []string{"a=a", "c=c"},
+			target:  []string{"a=a", "b=>a", "c=c"},
+			changes: []string{"Added: /b"},
+			entries: []string{"a", "b=>a"},
+		},
+		{
+			name:    "unchanged hardlinks",
+			base:    []string{"a=a", "b=>a"},
+			target:  []string{"a=a", "b=>a"},
+			changes: nil,
+			entries: nil,
+		},
+		{
+			name:    "broken hardlink",
+			base:    []string{"a=a", "b=>a"},
+			target:  []string{"a=a", "b=a"},
+			changes: []string{"Modified: /b"},
+			entries: []string{"b"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "layer-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			base := ""
+			if tt.base != nil {
+				base = filepath.Join(dir, "base")
+				makeTree(t, base, tt.base...)
+			}
+			target := filepath.Join(dir, "target")
+			makeTree(t, target, tt.target...)
+
+			changes, err := layer.Changes(base, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, c := range changes {
+				actual = append(actual, c.String())
+			}
+			if !reflect.DeepEqual(actual, tt.changes) {
+				t.Errorf("expected changes %q but got %q", tt.changes, actual)
+			}
+
+			buf := &bytes.Buffer{}
+			diffID, err := layer.Diff(buf, base, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diffID != digest.FromBytes(buf.Bytes()) {
+				t.Errorf("DiffID %s does not match the layer", diffID)
+			}
+			if entries := tarEntries(t, buf.Bytes()); !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("expected entries %q but got %q", tt.entries, entries)
+			}
+			if err := schema.ValidatorMediaTypeImageLayer.Validate(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Errorf("invalid layer: %v", err)
+			}
+		})
+	}
+}
+
+func TestDiffReproducible(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var diffIDs []digest.Digest
+	for i := 0; i < 2; i++ {
+		target := filepath.Join(dir, fmt.Sprint(i))
+		makeTree(t, target, "etc/", "etc/hosts=127.0.0.1 localhost", "etc/localtime->/usr/share/zoneinfo/UTC")
+		diffID, err := layer.Diff(ioutil.Discard, "", target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diffIDs = append(diffIDs, diffID)
+	}
+	if diffIDs[0] != diffIDs[1] {
+		t.Errorf("expected equal trees to have the same DiffID but got %v", diffIDs)
+	}
+}
+
+func TestDiffWhiteoutName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	makeTree(t, dir, ".wh.a=")
+	if _, err := layer.Diff(ioutil.Discard, "", dir); err == nil {
+		t.Error("expected an error for a file with the whiteout prefix")
+	}
+}
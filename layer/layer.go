@@ -0,0 +1,44 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package layer implements the image layer filesystem changesets
+// described in layer.md.
+package layer
+
+import (
+	_ "crypto/sha256" // side-effect to install impls, sha256
+)
+
+// Whiteout file name prefixes, see layer.md.
+const (
+	// WhiteoutPrefix prefixes the base name of a path to be deleted.
+	WhiteoutPrefix = ".wh."
+
+	// WhiteoutMetaPrefix prefixes the names of whiteout meta entries.
+	WhiteoutMetaPrefix = WhiteoutPrefix + WhiteoutPrefix
+
+	// WhiteoutOpaqueDir is the name of the opaque whiteout entry, which
+	// hides all children of its directory in the lower layers.
+	WhiteoutOpaqueDir = WhiteoutMetaPrefix + ".opq"
+)
+
+// Extended attributes of the overlay filesystem.
+const (
+	// overlayXattrPrefix prefixes the extended attributes
+	// reserved by the overlay filesystem.
+	overlayXattrPrefix = "trusted.overlay."
+
+	// overlayOpaqueXattr is set to "y" on opaque directories.
+	overlayOpaqueXattr = overlayXattrPrefix + "opaque"
+)
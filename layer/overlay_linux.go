@@ -0,0 +1,53 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package layer
+
+import (
+	"os"
+	"syscall"
+)
+
+// isOverlayWhiteout reports whether fi is an overlay whiteout,
+// a character device with device number 0/0.
+func isOverlayWhiteout(fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st := stat(fi)
+	return st.major == 0 && st.minor == 0
+}
+
+// isOverlayOpaque reports whether the directory dir is an opaque
+// overlay directory, hiding the lower directories.
+func isOverlayOpaque(dir string) (bool, error) {
+	value, err := getxattr(dir, overlayOpaqueXattr)
+	if err == syscall.ENODATA || err == syscall.ENOTSUP {
+		return false, nil
+	}
+	return value == "y", err
+}
+
+// overlayWhiteout creates an overlay whiteout at path.
+func overlayWhiteout(path string) error {
+	return syscall.Mknod(path, syscall.S_IFCHR, 0)
+}
+
+// overlayOpaque makes the directory dir an opaque overlay directory.
+func overlayOpaque(dir string) error {
+	return setxattr(dir, overlayOpaqueXattr, "y")
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestOverlay(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("overlay whiteouts require privileges")
+	}
+
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// extract the layer as an overlay upper directory
+	upper := filepath.Join(dir, "upper")
+	if err := os.Mkdir(upper, 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := buildLayer(t, "a/", "a/.wh.b", "c/", "c/.wh..wh..opq", "c/x=x", "d=d", ".wh.d", ".wh.e")
+	_, err = layer.Apply(upper, bytes.NewReader(p), v1.MediaTypeImageLayer, layer.ApplyOptions{Whiteouts: layer.WhiteoutOverlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a/b", "e"} {
+		var st syscall.Stat_t
+		if err := syscall.Lstat(filepath.Join(upper, name), &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Mode&syscall.S_IFMT != syscall.S_IFCHR || st.Rdev != 0 {
+			t.Errorf("expected %s to be an overlay whiteout but got mode %o, device %d", name, st.Mode, st.Rdev)
+		}
+	}
+	value := make([]byte, 1)
+	if n, err := syscall.Getxattr(filepath.Join(upper, "c"), "trusted.overlay.opaque", value); err != nil || string(value[:n]) != "y" {
+		t.Errorf("expected c to be opaque: %v", err)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(upper, "d")); err != nil || string(content) != "d" {
+		t.Errorf("expected d to be kept: %q, %v", content, err)
+	}
+
+	// and build a layer from it again
+	buf := &bytes.Buffer{}
+	if _, err := layer.DiffOverlay(buf, upper); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".wh.e", "a/", "a/.wh.b", "c/", "c/.wh..wh..opq", "c/x", "d"}
+	if entries := tarEntries(t, buf.Bytes()); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entries %q but got %q", expected, entries)
+	}
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hdr.Xattrs) != 0 {
+			t.Errorf("unexpected extended attributes %v of %s", hdr.Xattrs, hdr.Name)
+		}
+	}
+	if err := schema.ValidatorMediaTypeImageLayer.Validate(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("invalid layer: %v", err)
+	}
+
+	rootfs := filepath.Join(dir, "rootfs")
+	makeTree(t, rootfs, "a/", "a/b=b", "c/", "c/y=y", "e=e")
+	if _, err := layer.Apply(rootfs, buf, v1.MediaTypeImageLayer, layer.ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if files, expected := listTree(t, rootfs), []string{"a/", "c/", "c/x=x", "d=d"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %q but got %q", expected, files)
+	}
+}
+
+func TestOverlayWhiteoutOfLayerDirectory(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("overlay whiteouts require privileges")
+	}
+
+	dir, err := ioutil.TempDir("", "layer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the directory of the layer hides the lower one
+	p := buildLayer(t, "d/", "d/x=x", ".wh.d")
+	if _, err := layer.Apply(dir, bytes.NewReader(p), v1.MediaTypeImageLayer, layer.ApplyOptions{Whiteouts: layer.WhiteoutOverlay}); err != nil {
+		t.Fatal(err)
+	}
+	value := make([]byte, 1)
+	if n, err := syscall.Getxattr(filepath.Join(dir, "d"), "trusted.overlay.opaque", value); err != nil || string(value[:n]) != "y" {
+		t.Errorf("expected d to be opaque: %v", err)
+	}
+}
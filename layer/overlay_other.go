@@ -0,0 +1,44 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package layer
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// isOverlayWhiteout reports false, overlay filesystems are linux only.
+func isOverlayWhiteout(fi os.FileInfo) bool {
+	return false
+}
+
+// isOverlayOpaque reports false, overlay filesystems are linux only.
+func isOverlayOpaque(dir string) (bool, error) {
+	return false, nil
+}
+
+// overlayWhiteout fails, overlay filesystems are linux only.
+func overlayWhiteout(path string) error {
+	return errors.New("overlay whiteouts are not supported on this platform")
+}
+
+// overlayOpaque fails, overlay filesystems are linux only.
+func overlayOpaque(dir string) error {
+	return errors.New("overlay whiteouts are not supported on this platform")
+}
@@ -0,0 +1,457 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Source is a layer to be squashed.
+type Source struct {
+	// MediaType is the layer media type of the layer.
+	MediaType string
+
+	// Open returns a reader for the layer. It is called twice
+	// and must return the same content both times.
+	Open func() (io.ReadCloser, error)
+}
+
+// Squash writes the changeset of applying layers in order to w as a
+// single uncompressed layer tar archive, and returns the DiffID of the
+// layer. Applying the squashed layer has the same effect as applying
+// the layers one after the other. The layers are streamed twice, once
+// for their headers and once for their content; nothing is extracted.
+//
+// Whiteouts and opaque whiteouts are resolved: files deleted or
+// replaced by a later layer are dropped, and only the whiteouts of
+// files below the squashed layers are kept, before all other entries.
+// Hardlinks between the squashed layers are preserved. Hardlinks to
+// files below them fail if the target is changed by a later layer.
+// Paths are not resolved through symbolic links.
+func Squash(w io.Writer, layers []Source) (digest.Digest, error) {
+	s := &squasher{
+		root:       &node{},
+		sources:    map[sourceKey]*source{},
+		lowerLinks: map[string]string{},
+	}
+	for i, l := range layers {
+		p := &pending{}
+		if err := s.read(i, l, p.collect); err != nil {
+			return "", errors.Wrapf(err, "layer %d", i)
+		}
+		if err := s.merge(p); err != nil {
+			return "", errors.Wrapf(err, "layer %d", i)
+		}
+	}
+	if err := s.checkLowerLinks(); err != nil {
+		return "", err
+	}
+	s.assignPaths(s.root, "")
+
+	digester := digest.Canonical.Digester()
+	tw := tar.NewWriter(io.MultiWriter(w, digester.Hash()))
+	if err := s.writeWhiteouts(tw, s.root, "", false); err != nil {
+		return "", err
+	}
+	for i, l := range layers {
+		err := s.read(i, l, func(i, n int, hdr *tar.Header, r io.Reader) error {
+			return s.write(tw, s.sources[sourceKey{i, n}], hdr, r)
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "layer %d", i)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", errors.Wrap(err, "unable to write the layer")
+	}
+	return digester.Digest(), nil
+}
+
+// sourceKey identifies the entry n of the layer i.
+type sourceKey struct {
+	layer, entry int
+}
+
+// source is an entry providing a file of the squashed layer.
+type source struct {
+	dir bool
+
+	// link is the target of a hardlink to a file below the layers.
+	link string
+
+	// paths are the paths of the file in the squashed layer.
+	// All but the first are written as hardlinks.
+	paths []string
+}
+
+// node is a path of the squashed layer.
+type node struct {
+	children map[string]*node
+
+	// src provides the file at the path, if any.
+	src *source
+
+	// whiteout reports whether the lower file at the path is deleted,
+	// and opaque whether the lower children of the directory are.
+	whiteout, opaque bool
+}
+
+type squasher struct {
+	root    *node
+	sources map[sourceKey]*source
+
+	// lowerLinks maps the hardlinks to files below the layers
+	// to their targets.
+	lowerLinks map[string]string
+}
+
+// read calls fn for every entry of the layer l with index i but the root
+// directory, with the entry path as the header name.
+func (s *squasher) read(i int, l Source, fn func(i, n int, hdr *tar.Header, r io.Reader) error) error {
+	rc, err := l.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	r, err := decompress(rc, l.MediaType)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for n := 0; ; n++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to read the layer tar archive")
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			// pax global headers hold no file
+			continue
+		}
+		name, err := entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		hdr.Name = name
+		if err := fn(i, n, hdr, tr); err != nil {
+			return errors.Wrapf(err, "layer entry %q", name)
+		}
+	}
+	// the reader may verify the layer at its end
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		return errors.Wrap(err, "unable to read the layer")
+	}
+	return nil
+}
+
+// pending holds the entries of a layer to be merged.
+type pending struct {
+	opaque, whiteouts []string
+	entries           []*tar.Header
+	keys              []sourceKey
+}
+
+// collect records the entry n of the layer i.
+func (p *pending) collect(i, n int, hdr *tar.Header, r io.Reader) error {
+	dir, base := path.Split(hdr.Name)
+	dir = path.Clean(dir)
+	switch {
+	case base == WhiteoutOpaqueDir:
+		p.opaque = append(p.opaque, dir)
+	case strings.HasPrefix(base, WhiteoutMetaPrefix):
+		return errors.New("unknown whiteout meta entry")
+	case strings.HasPrefix(base, WhiteoutPrefix):
+		p.whiteouts = append(p.whiteouts, path.Join(dir, strings.TrimPrefix(base, WhiteoutPrefix)))
+	default:
+		h := *hdr
+		p.entries = append(p.entries, &h)
+		p.keys = append(p.keys, sourceKey{i, n})
+	}
+	return nil
+}
+
+// merge merges the changes of a layer into the squashed layer. The
+// whiteouts of a layer only apply to the lower layers, wherever they
+// appear in the layer, so they are merged before its other entries.
+func (s *squasher) merge(p *pending) error {
+	for _, dir := range p.opaque {
+		n := s.lookup(dir, true)
+		n.children = nil
+		n.opaque = true
+	}
+	for _, name := range p.whiteouts {
+		n := s.lookup(name, true)
+		*n = node{whiteout: true}
+	}
+
+	for i, hdr := range p.entries {
+		n := s.lookup(hdr.Name, true)
+		if hdr.Typeflag == tar.TypeDir {
+			// an existing directory is merged
+			if n.src != nil && !n.src.dir {
+				n.children = nil
+			}
+			n.src = &source{dir: true}
+			s.sources[p.keys[i]] = n.src
+			continue
+		}
+
+		src, shared := &source{}, false
+		if hdr.Typeflag == tar.TypeLink {
+			target, err := entryPath(hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			t := s.lookup(target, false)
+			switch {
+			case t != nil && t.src != nil && t.src.dir:
+				return errors.Errorf("layer entry %q: hardlink target %q is a directory", hdr.Name, hdr.Linkname)
+			case t != nil && t.src != nil:
+				src, shared = t.src, true
+			case t != nil && t.whiteout:
+				return errors.Errorf("layer entry %q: hardlink target %q is deleted", hdr.Name, hdr.Linkname)
+			default:
+				src.link = target
+				s.lowerLinks[hdr.Name] = target
+			}
+		}
+		if !shared {
+			s.sources[p.keys[i]] = src
+		}
+		*n = node{src: src, whiteout: true}
+	}
+	return nil
+}
+
+// lookup returns the node of the path name. Missing nodes are created
+// if create is set, and reported as nil otherwise.
+func (s *squasher) lookup(name string, create bool) *node {
+	n := s.root
+	if name == "." || name == "" {
+		return n
+	}
+	for _, c := range strings.Split(name, "/") {
+		child, ok := n.children[c]
+		if !ok {
+			if !create {
+				return nil
+			}
+			if n.children == nil {
+				n.children = map[string]*node{}
+			}
+			child = &node{}
+			n.children[c] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// checkLowerLinks fails if the target of a hardlink to a file below the
+// layers is changed, as the squashed layer changes it before the hardlink
+// is created.
+func (s *squasher) checkLowerLinks() error {
+	for name, target := range s.lowerLinks {
+		n := s.lookup(name, false)
+		if n == nil || n.src == nil || n.src.link != target {
+			// replaced by a later layer
+			continue
+		}
+		t := s.root
+		changed := t.opaque
+		for _, c := range strings.Split(target, "/") {
+			if t = t.children[c]; t == nil {
+				break
+			}
+			changed = changed || t.whiteout || t.opaque || t.src != nil && !t.src.dir
+		}
+		if changed {
+			return errors.Errorf("hardlink %q to %q cannot be squashed, a later layer changes its target", name, target)
+		}
+	}
+	return nil
+}
+
+// assignPaths assigns the sources of n and its children
+// their paths, in sorted order.
+func (s *squasher) assignPaths(n *node, name string) {
+	if n.src != nil && name != "" {
+		n.src.paths = append(n.src.paths, name)
+	}
+	for _, c := range sortedChildren(n) {
+		s.assignPaths(n.children[c], path.Join(name, c))
+	}
+}
+
+// writeWhiteouts writes the whiteouts of n, the node of the path name,
+// and of its children. The lower children of hidden nodes are already
+// deleted.
+func (s *squasher) writeWhiteouts(tw *tar.Writer, n *node, name string, hidden bool) error {
+	if n.opaque && !hidden && !n.whiteout {
+		if err := writeWhiteout(tw, path.Join(name, WhiteoutOpaqueDir)); err != nil {
+			return err
+		}
+	}
+	hidden = hidden || n.opaque || n.whiteout
+	for _, c := range sortedChildren(n) {
+		child := n.children[c]
+		// entries other than directories replace the lower files anyway
+		replaced := child.src != nil && !child.src.dir
+		if child.whiteout && !hidden && !replaced {
+			if err := writeWhiteout(tw, path.Join(name, WhiteoutPrefix+c)); err != nil {
+				return err
+			}
+		}
+		if err := s.writeWhiteouts(tw, child, path.Join(name, c), hidden); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the file provided by the entry hdr of src, if any,
+// and its hardlinks to tw.
+func (s *squasher) write(tw *tar.Writer, src *source, hdr *tar.Header, r io.Reader) error {
+	if src == nil || len(src.paths) == 0 {
+		return nil
+	}
+
+	h := *hdr
+	h.Name = src.paths[0]
+	if src.dir {
+		h.Name += "/"
+	}
+	if src.link != "" {
+		h.Linkname = src.link
+	}
+	if err := tw.WriteHeader(&h); err != nil {
+		return errors.Wrapf(err, "unable to write %s to the layer", src.paths[0])
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return errors.Wrapf(err, "unable to write %s to the layer", src.paths[0])
+	}
+
+	for _, name := range src.paths[1:] {
+		link := &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeLink,
+			Linkname: src.paths[0],
+			ModTime:  hdr.ModTime,
+			Mode:     hdr.Mode,
+			Uid:      hdr.Uid,
+			Gid:      hdr.Gid,
+		}
+		if src.link != "" {
+			link.Linkname = src.link
+		}
+		if err := tw.WriteHeader(link); err != nil {
+			return errors.Wrapf(err, "unable to write %s to the layer", name)
+		}
+	}
+	return nil
+}
+
+// writeWhiteout writes the whiteout entry name to tw.
+func writeWhiteout(tw *tar.Writer, name string) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		ModTime:  time.Unix(0, 0),
+	})
+	return errors.Wrapf(err, "unable to write %s to the layer", name)
+}
+
+// sortedChildren returns the sorted names of the children of n.
+func sortedChildren(n *node) []string {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SquashConfig returns a copy of config for the image whose layers start
+// to end-1 are squashed into the layer with the given DiffID. The DiffIDs
+// of the squashed layers are replaced by diffID, and their history
+// entries, with the empty layer entries between them, are folded into
+// one. The folded entry takes the creation time and author of the last
+// of them and joins their commands. The history may be empty; otherwise
+// its non-empty layer entries must match the layers.
+func SquashConfig(config v1.Image, start, end int, diffID digest.Digest) (v1.Image, error) {
+	diffIDs := config.RootFS.DiffIDs
+	if start < 0 || end > len(diffIDs) || start >= end {
+		return v1.Image{}, errors.Errorf("invalid layer range [%d, %d) of %d layers", start, end, len(diffIDs))
+	}
+	config.RootFS.DiffIDs = append(append(append([]digest.Digest{}, diffIDs[:start]...), diffID), diffIDs[end:]...)
+
+	if len(config.History) == 0 {
+		return config, nil
+	}
+
+	// first and last are the history entries of the layers start and end-1
+	first, last, layers := -1, -1, 0
+	for i, h := range config.History {
+		if h.EmptyLayer {
+			continue
+		}
+		if layers == start {
+			first = i
+		}
+		if layers == end-1 {
+			last = i
+		}
+		layers++
+	}
+	if layers != len(diffIDs) {
+		return v1.Image{}, errors.Errorf("%d history entries of layers do not match %d layers", layers, len(diffIDs))
+	}
+
+	folded := v1.History{
+		Created: config.History[last].Created,
+		Author:  config.History[last].Author,
+		Comment: fmt.Sprintf("squashed %d layers", end-start),
+	}
+	var commands []string
+	for _, h := range config.History[first : last+1] {
+		if h.CreatedBy != "" {
+			commands = append(commands, h.CreatedBy)
+		}
+	}
+	folded.CreatedBy = strings.Join(commands, "; ")
+
+	history := append([]v1.History{}, config.History[:first]...)
+	history = append(history, folded)
+	config.History = append(history, config.History[last+1:]...)
+	return config, nil
+}
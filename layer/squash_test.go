@@ -0,0 +1,240 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layer_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// sources returns the layers as squash sources.
+func sources(layers ...[]byte) []layer.Source {
+	var srcs []layer.Source
+	for _, p := range layers {
+		p := p
+		srcs = append(srcs, layer.Source{
+			MediaType: v1.MediaTypeImageLayer,
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(p)), nil
+			},
+		})
+	}
+	return srcs
+}
+
+func TestSquash(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		lower    []string
+		layers   [][]string
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "later layers replace files",
+			lower:    []string{"etc/", "etc/hosts=a"},
+			layers:   [][]string{{"etc/", "etc/hosts=b", "tmp=x"}, {"etc/hosts=c"}},
+			expected: []string{"etc/", "tmp", "etc/hosts"},
+		},
+		{
+			name:     "whiteouts of lower files are kept",
+			lower:    []string{"a=a", "b=b", "d/", "d/x=x"},
+			layers:   [][]string{{".wh.a", "c=c"}, {".wh.c", "d/.wh.x"}},
+			expected: []string{".wh.a", ".wh.c", "d/.wh.x"},
+		},
+		{
+			name:     "files of deleted directories are dropped",
+			lower:    []string{"d/", "d/x=x"},
+			layers:   [][]string{{"d/", "d/y=y"}, {".wh.d"}, {"d/z=z"}},
+			expected: []string{".wh.d", "d/z"},
+		},
+		{
+			name:     "opaque whiteout",
+			lower:    []string{"d/", "d/x=x", "d/y=y"},
+			layers:   [][]string{{"d/y=new", "d/e/", "d/e/.wh.f"}, {"d/.wh..wh..opq", "d/z=z"}},
+			expected: []string{"d/.wh..wh..opq", "d/z"},
+		},
+		{
+			name:     "opaque whiteout of a deleted directory",
+			lower:    []string{"d/", "d/x=x"},
+			layers:   [][]string{{".wh.d", "d/", "d/y=y"}, {"d/.wh..wh..opq"}},
+			expected: []string{".wh.d", "d/"},
+		},
+		{
+			name:     "file replaced by a directory",
+			lower:    []string{"a=a"},
+			layers:   [][]string{{"a/", "a/b=b"}, {"a/c=c"}},
+			expected: []string{"a/", "a/b", "a/c"},
+		},
+		{
+			name:     "lower directory replaced by a file and a directory",
+			lower:    []string{"a/", "a/x=x"},
+			layers:   [][]string{{"a=a"}, {"a/", "a/b=b"}},
+			expected: []string{".wh.a", "a/", "a/b"},
+		},
+		{
+			name:     "hardlinks",
+			layers:   [][]string{{"a=a", "b=>a"}, {"c=>b", ".wh.a"}, {"b=new"}},
+			expected: []string{".wh.a", "c", "b"},
+		},
+		{
+			name:     "hardlink to a lower file",
+			lower:    []string{"a=a"},
+			layers:   [][]string{{"b=>a"}, {"c=>b"}},
+			expected: []string{"b=>a", "c=>a"},
+		},
+		{
+			name:   "hardlink to a changed lower file",
+			lower:  []string{"a=a"},
+			layers: [][]string{{"b=>a"}, {"a=new"}},
+			err:    true,
+		},
+		{
+			name:   "hardlink to a directory",
+			layers: [][]string{{"a/"}, {"b=>a"}},
+			err:    true,
+		},
+		{
+			name:   "unknown whiteout meta entry",
+			layers: [][]string{{".wh..wh.x"}},
+			err:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "layer-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			var layers [][]byte
+			for _, specs := range tt.layers {
+				layers = append(layers, buildLayer(t, specs...))
+			}
+			buf := &bytes.Buffer{}
+			diffID, err := layer.Squash(buf, sources(layers...))
+			if tt.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := digest.FromBytes(buf.Bytes()); diffID != expected {
+				t.Errorf("expected DiffID %s but got %s", expected, diffID)
+			}
+			if entries := tarEntries(t, buf.Bytes()); !reflect.DeepEqual(entries, tt.expected) {
+				t.Errorf("expected entries %q but got %q", tt.expected, entries)
+			}
+			// hardlinks to lower files are no earlier entries of a layer
+			valid := true
+			for _, p := range layers {
+				valid = valid && schema.ValidatorMediaTypeImageLayer.Validate(bytes.NewReader(p)) == nil
+			}
+			if err := schema.ValidatorMediaTypeImageLayer.Validate(bytes.NewReader(buf.Bytes())); valid && err != nil {
+				t.Errorf("squashed layer is invalid: %v", err)
+			}
+
+			opts := layer.ApplyOptions{IgnoreOwnership: true}
+			expected := filepath.Join(dir, "expected")
+			makeTree(t, expected, tt.lower...)
+			for _, p := range layers {
+				if _, err := layer.Apply(expected, bytes.NewReader(p), v1.MediaTypeImageLayer, opts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			squashed := filepath.Join(dir, "squashed")
+			makeTree(t, squashed, tt.lower...)
+			if _, err := layer.Apply(squashed, buf, v1.MediaTypeImageLayer, opts); err != nil {
+				t.Fatal(err)
+			}
+			if files, expected := listTree(t, squashed), listTree(t, expected); !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected %q but got %q", expected, files)
+			}
+		})
+	}
+}
+
+func TestSquashConfig(t *testing.T) {
+	created := func(hour int) *time.Time {
+		t := testTime.Add(time.Duration(hour) * time.Hour)
+		return &t
+	}
+	config := v1.Image{
+		RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{"sha256:a", "sha256:b", "sha256:c", "sha256:d"}},
+		History: []v1.History{
+			{Created: created(0), CreatedBy: "add a"},
+			{Created: created(1), CreatedBy: "env", EmptyLayer: true},
+			{Created: created(2), CreatedBy: "add b"},
+			{Created: created(3), CreatedBy: "label", EmptyLayer: true},
+			{Created: created(4), CreatedBy: "add c", Author: "me"},
+			{Created: created(5), CreatedBy: "cmd", EmptyLayer: true},
+			{Created: created(6), CreatedBy: "add d"},
+		},
+	}
+
+	squashed, err := layer.SquashConfig(config, 1, 3, "sha256:s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []digest.Digest{"sha256:a", "sha256:s", "sha256:d"}; !reflect.DeepEqual(squashed.RootFS.DiffIDs, expected) {
+		t.Errorf("expected diff_ids %v but got %v", expected, squashed.RootFS.DiffIDs)
+	}
+	expected := []v1.History{
+		config.History[0],
+		config.History[1],
+		{Created: created(4), CreatedBy: "add b; label; add c", Author: "me", Comment: "squashed 2 layers"},
+		config.History[5],
+		config.History[6],
+	}
+	if !reflect.DeepEqual(squashed.History, expected) {
+		t.Errorf("expected history %+v but got %+v", expected, squashed.History)
+	}
+	if config.RootFS.DiffIDs[1] != "sha256:b" || len(config.History) != 7 {
+		t.Error("the config was modified")
+	}
+
+	config.History = nil
+	squashed, err = layer.SquashConfig(config, 0, 4, "sha256:s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(squashed.RootFS.DiffIDs) != 1 || squashed.History != nil {
+		t.Errorf("unexpected config %+v", squashed)
+	}
+
+	for _, r := range [][2]int{{-1, 1}, {2, 2}, {3, 5}} {
+		if _, err := layer.SquashConfig(config, r[0], r[1], "sha256:s"); err == nil {
+			t.Errorf("expected an error for the range %v", r)
+		}
+	}
+	config.History = []v1.History{{CreatedBy: "add a"}}
+	if _, err := layer.SquashConfig(config, 0, 2, "sha256:s"); err == nil {
+		t.Error("expected an error for a history not matching the layers")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package layer
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+)
+
+// stat returns the ownership, identity and device number of fi.
+func stat(fi os.FileInfo) sysStat {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sysStat{}
+	}
+	rdev := uint64(st.Rdev)
+	return sysStat{
+		uid:   int(st.Uid),
+		gid:   int(st.Gid),
+		dev:   uint64(st.Dev),
+		ino:   uint64(st.Ino),
+		nlink: uint64(st.Nlink),
+		major: int64((rdev>>8)&0xfff | (rdev>>32)&^0xfff),
+		minor: int64(rdev&0xff | (rdev>>12)&^0xff),
+	}
+}
+
+// xattrs returns the extended attributes of the file at path.
+// Symbolic links have none.
+func xattrs(path string) (map[string]string, error) {
+	if fi, err := os.Lstat(path); err != nil || fi.Mode()&os.ModeSymlink != 0 {
+		return nil, err
+	}
+	size, err := syscall.Listxattr(path, nil)
+	if err == syscall.ENOTSUP || err == syscall.ENODATA {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]string{}
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := getxattr(path, string(name))
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(name)] = value
+	}
+	return attrs, nil
+}
+
+func getxattr(path, name string) (string, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return "", err
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:size]), nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/canonical"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// CopyOptions configures Copy.
+type CopyOptions struct {
+	// Platforms, if not empty, narrows the image indexes being copied to
+	// the image manifests matching one of the platforms, see Resolve for
+	// how platforms match. Narrowed indexes are written anew, so their
+	// digests change. Nested indexes left without manifests are dropped.
+	Platforms []v1.Platform
+}
+
+// errNoManifests is returned by copyIndex for an image index
+// which has no manifest for the requested platforms.
+var errNoManifests = errors.New("no manifest matches the requested platforms")
+
+// Copy copies the blob desc refers to from src to dst, following image
+// indexes and manifests to everything they reference. Blobs which are
+// already in dst are not copied again. Copy returns the descriptor of
+// the copy, which only differs from desc if an index was narrowed.
+// index.json of dst is left unchanged; see CopyRef.
+func Copy(dst, src *Layout, desc v1.Descriptor, opts CopyOptions) (v1.Descriptor, error) {
+	c := &copier{
+		dst:    dst,
+		src:    src,
+		opts:   opts,
+		copied: map[digest.Digest]v1.Descriptor{},
+	}
+
+	if desc.MediaType == v1.MediaTypeImageManifest && len(opts.Platforms) > 0 {
+		ok, err := c.matches(desc)
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		if !ok {
+			return v1.Descriptor{}, errors.Wrapf(errNoManifests, "manifest %s", desc.Digest)
+		}
+	}
+	return c.copy(desc)
+}
+
+// CopyRef copies the descriptor named name in src with Copy
+// and tags the copy with the same name in dst.
+func CopyRef(dst, src *Layout, name string, opts CopyOptions) (v1.Descriptor, error) {
+	desc, err := src.Resolve(name, nil)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	copied, err := Copy(dst, src, desc, opts)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := dst.Tag(name, copied); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return copied, nil
+}
+
+type copier struct {
+	dst, src *Layout
+	opts     CopyOptions
+
+	// copied maps the digests of the blobs copied so far to
+	// the descriptors of their copies.
+	copied map[digest.Digest]v1.Descriptor
+}
+
+func (c *copier) copy(desc v1.Descriptor) (v1.Descriptor, error) {
+	if copied, ok := c.copied[desc.Digest]; ok {
+		desc.Digest, desc.Size = copied.Digest, copied.Size
+		return desc, nil
+	}
+
+	copied := desc
+	var err error
+	switch desc.MediaType {
+	case v1.MediaTypeImageIndex:
+		copied, err = c.copyIndex(desc)
+	case v1.MediaTypeImageManifest:
+		err = c.copyManifest(desc)
+	default:
+		err = c.copyBlob(desc)
+	}
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	c.copied[desc.Digest] = copied
+	return copied, nil
+}
+
+// copyManifest copies the config and layers of the manifest desc
+// refers to, and then the manifest itself.
+func (c *copier) copyManifest(desc v1.Descriptor) error {
+	var manifest v1.Manifest
+	if err := c.src.readJSON(desc, &manifest); err != nil {
+		return err
+	}
+	for _, d := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+		if _, err := c.copy(d); err != nil {
+			return err
+		}
+	}
+	return c.copyBlob(desc)
+}
+
+// copyIndex copies the manifests of the image index desc refers to,
+// and then the index itself, narrowing it to the requested platforms.
+// A narrowed index keeps all fields of the original, also those v1.Index
+// does not know about, and only its manifests array is edited.
+func (c *copier) copyIndex(desc v1.Descriptor) (v1.Descriptor, error) {
+	var index map[string]json.RawMessage
+	if err := c.src.readJSON(desc, &index); err != nil {
+		return v1.Descriptor{}, err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(index["manifests"], &entries); err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image layout %s: unable to parse blob %s", c.src.root, desc.Digest)
+	}
+
+	manifests := make([]json.RawMessage, 0, len(entries))
+	changed := false
+	for _, entry := range entries {
+		var m v1.Descriptor
+		if err := json.Unmarshal(entry, &m); err != nil {
+			return v1.Descriptor{}, errors.Wrapf(err, "image layout %s: unable to parse blob %s", c.src.root, desc.Digest)
+		}
+		if m.MediaType == v1.MediaTypeImageManifest && len(c.opts.Platforms) > 0 {
+			ok, err := c.matches(m)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			if !ok {
+				changed = true
+				continue
+			}
+		}
+
+		copied, err := c.copy(m)
+		if errors.Cause(err) == errNoManifests {
+			changed = true
+			continue
+		}
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		if copied.Digest != m.Digest {
+			changed = true
+			if entry, err = setFields(entry, map[string]interface{}{"digest": copied.Digest, "size": copied.Size}); err != nil {
+				return v1.Descriptor{}, err
+			}
+		}
+		manifests = append(manifests, entry)
+	}
+
+	if len(manifests) == 0 && len(c.opts.Platforms) > 0 {
+		return v1.Descriptor{}, errors.Wrapf(errNoManifests, "index %s", desc.Digest)
+	}
+	if !changed {
+		return desc, c.copyBlob(desc)
+	}
+
+	p, err := json.Marshal(manifests)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	index["manifests"] = p
+	if p, err = canonical.Marshal(index); err != nil {
+		return v1.Descriptor{}, err
+	}
+	dgst, size, err := c.dst.PutBlob(bytes.NewReader(p))
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc.Digest, desc.Size = dgst, size
+	return desc, nil
+}
+
+// setFields returns the JSON object p with the given fields replaced,
+// keeping all other fields.
+func setFields(p json.RawMessage, fields map[string]interface{}) (json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(p, &object); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = v
+	}
+	return json.Marshal(object)
+}
+
+// matches reports whether the image manifest desc refers to
+// matches one of the requested platforms.
+func (c *copier) matches(desc v1.Descriptor) (bool, error) {
+	for i := range c.opts.Platforms {
+		found, err := c.src.matchPlatform(desc, &c.opts.Platforms[i])
+		if err != nil {
+			return false, err
+		}
+		if len(found) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// copyBlob copies the blob desc refers to, unless it is already in dst.
+func (c *copier) copyBlob(desc v1.Descriptor) error {
+	if size, err := c.dst.Stat(desc.Digest); err == nil && size == desc.Size {
+		return nil
+	}
+
+	rc, err := c.src.Fetch(desc)
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to get blob %s", c.src.root, desc.Digest)
+	}
+	defer rc.Close()
+
+	_, err = c.dst.PutBlobDigest(rc, desc.Digest)
+	return errors.Wrapf(err, "image layout %s: unable to copy blob %s", c.src.root, desc.Digest)
+}
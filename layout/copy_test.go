@@ -0,0 +1,270 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// blobDigests returns the digests of the blobs stored in l.
+func blobDigests(t *testing.T, l *layout.Layout) []digest.Digest {
+	report, err := l.GC(layout.GCOptions{DryRun: true, MinAge: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with an empty index.json every blob is unreachable
+	return report.Removed
+}
+
+func TestCopy(t *testing.T) {
+	src := createLayout(t)
+	defer removeLayout(src)
+
+	linuxArm := v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	amd64 := putImage(t, src, "amd64", linuxAmd64)
+	arm := putImage(t, src, "arm", linuxArm)
+	index := putJSON(t, src, v1.MediaTypeImageIndex, v1.Index{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		Manifests:   []v1.Descriptor{amd64, arm},
+		Annotations: map[string]string{"org.example.key": "value"},
+	})
+	if err := src.Tag("v1.0", index); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		platforms []v1.Platform
+		manifests []v1.Descriptor
+		err       bool
+	}{
+		{name: "whole index", manifests: []v1.Descriptor{amd64, arm}},
+		{name: "one platform", platforms: []v1.Platform{linuxAmd64}, manifests: []v1.Descriptor{amd64}},
+		{name: "all platforms", platforms: []v1.Platform{linuxArm, linuxAmd64}, manifests: []v1.Descriptor{amd64, arm}},
+		{name: "no platform", platforms: []v1.Platform{{OS: "windows", Architecture: "amd64"}}, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := createLayout(t)
+			defer removeLayout(dst)
+
+			desc, err := layout.CopyRef(dst, src, "v1.0", layout.CopyOptions{Platforms: tt.platforms})
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if names, _ := dst.Refs(); len(names) != 0 {
+					t.Errorf("unexpected refs %v", names)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc.Annotations[v1.AnnotationRefName] != "v1.0" {
+				t.Errorf("expected the copy to be tagged but got %+v", desc)
+			}
+			if changed := desc.Digest != index.Digest; changed != (len(tt.manifests) != 2) {
+				t.Errorf("unexpected digest %s of the copied index %s", desc.Digest, index.Digest)
+			}
+
+			var copied v1.Index
+			rc, err := dst.Get(desc.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.NewDecoder(rc).Decode(&copied)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(copied.Manifests, tt.manifests) {
+				t.Errorf("expected manifests %+v but got %+v", tt.manifests, copied.Manifests)
+			}
+			if copied.Annotations["org.example.key"] != "value" {
+				t.Errorf("annotations were not kept: %+v", copied.Annotations)
+			}
+
+			// every blob of dst is reachable and valid
+			if findings, err := dst.Fsck(schema.Options{}); err != nil || len(findings) != 0 {
+				t.Errorf("unexpected findings %v: %v", findings, err)
+			}
+			if report, err := dst.GC(layout.GCOptions{DryRun: true, MinAge: -1}); err != nil || len(report.Removed) != 0 {
+				t.Errorf("unexpected unreachable blobs %v: %v", report.Removed, err)
+			}
+		})
+	}
+}
+
+func TestCopyDeduplicates(t *testing.T) {
+	src := createLayout(t)
+	defer removeLayout(src)
+	dst := createLayout(t)
+	defer removeLayout(dst)
+
+	manifest := putImage(t, src, "a", linuxAmd64)
+	if _, err := layout.Copy(dst, src, manifest, layout.CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if blobs := blobDigests(t, dst); len(blobs) != 3 {
+		t.Fatalf("expected 3 blobs but got %v", blobs)
+	}
+
+	// blobs already in dst are not read from src again
+	var m v1.Manifest
+	rc, err := src.Get(manifest.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := src.BlobPath(m.Layers[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	second := putImage(t, src, "b", linuxAmd64)
+	index := putJSON(t, src, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{manifest, second},
+	})
+	if _, err := layout.Copy(dst, src, index, layout.CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if blobs := blobDigests(t, dst); len(blobs) != 7 {
+		t.Errorf("expected 7 blobs but got %v", blobs)
+	}
+
+	// blobs missing in dst are verified while they are copied
+	other := createLayout(t)
+	defer removeLayout(other)
+	if _, err := layout.Copy(other, src, manifest, layout.CopyOptions{}); err == nil {
+		t.Error("expected a corrupt blob to fail the copy")
+	}
+}
+
+func TestCopyNestedIndex(t *testing.T) {
+	src := createLayout(t)
+	defer removeLayout(src)
+	dst := createLayout(t)
+	defer removeLayout(dst)
+
+	windows := v1.Platform{OS: "windows", Architecture: "amd64"}
+	amd64 := putImage(t, src, "amd64", linuxAmd64)
+	win := putImage(t, src, "windows", windows)
+	nested := putJSON(t, src, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{win},
+	})
+	index := putJSON(t, src, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{amd64, nested},
+	})
+
+	desc, err := layout.Copy(dst, src, index, layout.CopyOptions{Platforms: []v1.Platform{linuxAmd64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var copied v1.Index
+	rc, err := dst.Get(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.NewDecoder(rc).Decode(&copied)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(copied.Manifests, []v1.Descriptor{amd64}) {
+		t.Errorf("expected the nested index to be dropped but got %+v", copied.Manifests)
+	}
+	if _, err := dst.Stat(win.Digest); !os.IsNotExist(err) {
+		t.Errorf("expected the windows manifest not to be copied: %v", err)
+	}
+
+	// a manifest not matching the platforms is not copied at all
+	if _, err := layout.Copy(dst, src, win, layout.CopyOptions{Platforms: []v1.Platform{linuxAmd64}}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestCopyKeepsUnknownFields(t *testing.T) {
+	src := createLayout(t)
+	defer removeLayout(src)
+	dst := createLayout(t)
+	defer removeLayout(dst)
+
+	amd64 := putImage(t, src, "amd64", linuxAmd64)
+	arm := putImage(t, src, "arm", v1.Platform{OS: "linux", Architecture: "arm"})
+	inner := putJSON(t, src, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{amd64, arm},
+	})
+	index := putJSON(t, src, v1.MediaTypeImageIndex, map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []map[string]interface{}{{
+			"mediaType":         inner.MediaType,
+			"digest":            inner.Digest,
+			"size":              inner.Size,
+			"org.example.entry": "kept",
+		}},
+		"org.example.index": "kept",
+	})
+
+	desc, err := layout.Copy(dst, src, index, layout.CopyOptions{Platforms: []v1.Platform{linuxAmd64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest == index.Digest {
+		t.Fatal("expected the index to be narrowed")
+	}
+
+	rc, err := dst.Get(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var copied struct {
+		Manifests []map[string]interface{} `json:"manifests"`
+		Field     string                   `json:"org.example.index"`
+	}
+	err = json.NewDecoder(rc).Decode(&copied)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Field != "kept" {
+		t.Error("the unknown field of the index was dropped")
+	}
+	if len(copied.Manifests) != 1 || copied.Manifests[0]["org.example.entry"] != "kept" {
+		t.Errorf("the unknown field of the manifest entry was dropped: %v", copied.Manifests)
+	} else if copied.Manifests[0]["digest"] == inner.Digest.String() {
+		t.Error("expected the digest of the narrowed nested index")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+// Fsck checks the integrity of the image layout. It validates index.json
+// and follows its descriptors through image indexes and manifests to
+// configs and layers, validating every blob with schema.ValidateContents.
+// Dangling references, size and digest mismatches, invalid JSON and schema
+// violations are reported. Every file below blobs is checked to be named
+// after the digest of its content, including unreferenced blobs and blobs
+// stored in the directory of the wrong algorithm.
+//
+// All problems are collected into a single schema.ValidationError.
+// The warnings found in the blobs are returned either way.
+func (l *Layout) Fsck(opts schema.Options) ([]schema.Finding, error) {
+	var (
+		warnings []schema.Finding
+		errs     []error
+		findings []schema.Finding
+	)
+	merge := func(err error) {
+		if verr, ok := errors.Cause(err).(schema.ValidationError); ok {
+			errs = append(errs, verr.Errs...)
+			findings = append(findings, verr.Findings...)
+			return
+		}
+		errs = append(errs, err)
+	}
+
+	index, err := l.Index()
+	if err != nil {
+		merge(err)
+	} else {
+		warnings, err = schema.ValidateContents(index.Manifests, l, opts)
+		if err != nil {
+			merge(err)
+		}
+	}
+
+	errs = append(errs, l.checkBlobs()...)
+
+	if len(errs) == 0 {
+		return warnings, nil
+	}
+	return warnings, schema.ValidationError{
+		Errs:     errs,
+		Findings: findings,
+	}
+}
+
+// checkBlobs checks that every file below blobs is stored as
+// blobs/<alg>/<encoded> and that its content has that digest.
+// Hidden files, like those of interrupted writes, are skipped.
+func (l *Layout) checkBlobs() []error {
+	dirs, err := ioutil.ReadDir(filepath.Join(l.root, BlobsDir))
+	if err != nil {
+		return []error{errors.Wrapf(err, "image layout %s", l.root)}
+	}
+
+	var errs []error
+	for _, dir := range dirs {
+		if strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		rel := BlobsDir + "/" + dir.Name()
+		if !dir.IsDir() {
+			errs = append(errs, errors.Errorf("%s: not an algorithm directory", rel))
+			continue
+		}
+		alg := digest.Algorithm(dir.Name())
+		if !alg.Available() {
+			errs = append(errs, errors.Errorf("%s: unsupported digest algorithm %q", rel, alg))
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(l.root, BlobsDir, dir.Name()))
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, rel))
+			continue
+		}
+		for _, fi := range files {
+			if strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			if err := l.checkBlob(alg, fi); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s/%s", rel, fi.Name()))
+			}
+		}
+	}
+	return errs
+}
+
+// checkBlob checks that the content of the file fi
+// in the directory of alg has the digest <alg>:<name>.
+func (l *Layout) checkBlob(alg digest.Algorithm, fi os.FileInfo) error {
+	if !fi.Mode().IsRegular() {
+		return errors.New("not a regular file")
+	}
+
+	dgst := digest.NewDigestFromEncoded(alg, fi.Name())
+	if err := dgst.Validate(); err != nil {
+		for _, other := range []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512} {
+			if other != alg && digest.NewDigestFromEncoded(other, fi.Name()).Validate() == nil {
+				return errors.Errorf("blob with a %s digest is stored in the %s directory", other, alg)
+			}
+		}
+		return errors.Wrap(err, "not named after a digest")
+	}
+
+	f, err := os.Open(filepath.Join(l.root, BlobsDir, alg.String(), fi.Name()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	actual, err := alg.FromReader(f)
+	if err != nil {
+		return err
+	}
+	if actual != dgst {
+		return errors.Errorf("content does not match the digest, its digest is %s", actual)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/canonical"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// putBlob stores p in l and returns a descriptor for it.
+func putBlob(t *testing.T, l *layout.Layout, mediaType string, p []byte) v1.Descriptor {
+	dgst, size, err := l.PutBlob(bytes.NewReader(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v1.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      size,
+	}
+}
+
+// putJSON stores the canonical JSON encoding of v in l
+// and returns a descriptor for it.
+func putJSON(t *testing.T, l *layout.Layout, mediaType string, v interface{}) v1.Descriptor {
+	p, err := canonical.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return putBlob(t, l, mediaType, p)
+}
+
+// putImage stores an image with a single layer holding the given file
+// and returns the descriptor of its manifest.
+func putImage(t *testing.T, l *layout.Layout, file string, platform v1.Platform) v1.Descriptor {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{Name: file, Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer := putBlob(t, l, v1.MediaTypeImageLayer, buf.Bytes())
+
+	config := putJSON(t, l, v1.MediaTypeImageConfig, v1.Image{
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		RootFS:       v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{layer.Digest}},
+	})
+	manifest := putJSON(t, l, v1.MediaTypeImageManifest, v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    config,
+		Layers:    []v1.Descriptor{layer},
+	})
+	manifest.Platform = &platform
+	return manifest
+}
+
+var linuxAmd64 = v1.Platform{OS: "linux", Architecture: "amd64"}
+
+func TestFsck(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		setup    func(t *testing.T, l *layout.Layout)
+		messages []string
+	}{
+		{
+			name: "valid layout",
+			setup: func(t *testing.T, l *layout.Layout) {
+				manifest := putImage(t, l, "a", linuxAmd64)
+				index := putJSON(t, l, v1.MediaTypeImageIndex, v1.Index{
+					Versioned: specs.Versioned{SchemaVersion: 2},
+					Manifests: []v1.Descriptor{manifest},
+				})
+				for _, desc := range []v1.Descriptor{manifest, index} {
+					if err := l.AddDescriptor(desc); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+		},
+		{
+			name: "dangling reference",
+			setup: func(t *testing.T, l *layout.Layout) {
+				desc := putImage(t, l, "a", linuxAmd64)
+				desc.Digest = digest.FromString("missing")
+				if err := l.AddDescriptor(desc); err != nil {
+					t.Fatal(err)
+				}
+			},
+			messages: []string{"blob not found"},
+		},
+		{
+			name: "size mismatch",
+			setup: func(t *testing.T, l *layout.Layout) {
+				desc := putImage(t, l, "a", linuxAmd64)
+				desc.Size++
+				if err := l.AddDescriptor(desc); err != nil {
+					t.Fatal(err)
+				}
+			},
+			messages: []string{"does not match the declared size"},
+		},
+		{
+			name: "corrupted blob",
+			setup: func(t *testing.T, l *layout.Layout) {
+				desc := putBlob(t, l, "application/octet-stream", []byte("content"))
+				writeBlobFile(t, l, desc.Digest.Algorithm().String(), desc.Digest.Encoded(), "tampered")
+			},
+			messages: []string{"content does not match the digest"},
+		},
+		{
+			name: "wrong algorithm directory",
+			setup: func(t *testing.T, l *layout.Layout) {
+				p := []byte("content")
+				writeBlobFile(t, l, "sha512", digest.SHA256.FromBytes(p).Encoded(), string(p))
+			},
+			messages: []string{"sha256 digest is stored in the sha512 directory"},
+		},
+		{
+			name: "unparseable JSON",
+			setup: func(t *testing.T, l *layout.Layout) {
+				if err := l.AddDescriptor(putBlob(t, l, v1.MediaTypeImageManifest, []byte("{\n  \"schemaVersion\": 2,\n  oops\n}"))); err != nil {
+					t.Fatal(err)
+				}
+			},
+			messages: []string{"manifest format mismatch at line 3"},
+		},
+		{
+			name: "unparseable index.json",
+			setup: func(t *testing.T, l *layout.Layout) {
+				if err := ioutil.WriteFile(filepath.Join(l.Path(), layout.IndexFile), []byte(`{"schemaVersion": 2,`), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			messages: []string{"index format mismatch"},
+		},
+		{
+			name: "schema violation",
+			setup: func(t *testing.T, l *layout.Layout) {
+				config := putJSON(t, l, v1.MediaTypeImageConfig, map[string]interface{}{"os": "linux", "rootfs": v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{}}})
+				if err := l.AddDescriptor(config); err != nil {
+					t.Fatal(err)
+				}
+			},
+			messages: []string{"architecture is required"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := createLayout(t)
+			defer removeLayout(l)
+			tt.setup(t, l)
+
+			_, err := l.Fsck(schema.Options{})
+			if len(tt.messages) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			verr, ok := errors.Cause(err).(schema.ValidationError)
+			if !ok {
+				t.Fatalf("expected a validation error but got %v", err)
+			}
+			if len(verr.Errs) != len(tt.messages) {
+				t.Fatalf("expected %d errors but got %v", len(tt.messages), verr.Errs)
+			}
+			for i, err := range verr.Errs {
+				if !strings.Contains(err.Error(), tt.messages[i]) {
+					t.Errorf("expected error %q to contain %q", err, tt.messages[i])
+				}
+			}
+		})
+	}
+}
+
+// writeBlobFile writes content to blobs/<alg>/<name> of l, bypassing PutBlob.
+func writeBlobFile(t *testing.T, l *layout.Layout, alg, name, content string) {
+	dir := filepath.Join(l.Path(), layout.BlobsDir, alg)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// DefaultGCMinAge is the grace period of GC if GCOptions.MinAge is zero.
+const DefaultGCMinAge = time.Hour
+
+// GCOptions configures a garbage collection run.
+type GCOptions struct {
+	// DryRun reports the unreachable blobs without removing them.
+	DryRun bool
+
+	// MinAge is the grace period of unreachable blobs: blobs written
+	// less than MinAge ago are kept, as a writer may still reference
+	// them from index.json. Zero means DefaultGCMinAge; a negative
+	// value removes unreachable blobs regardless of their age.
+	MinAge time.Duration
+}
+
+// GCReport describes the result of a garbage collection run.
+type GCReport struct {
+	// Removed lists the unreachable blobs, sorted by digest.
+	// In a dry run they are left in place.
+	Removed []digest.Digest
+
+	// Reclaimed is the total size of the unreachable blobs, in bytes.
+	Reclaimed int64
+}
+
+// GC removes the blobs which cannot be reached from the descriptors of
+// index.json. Image indexes and manifests are followed recursively, to
+// their manifests and to their config and layers. Referenced blobs which
+// are missing are skipped, but GC fails without removing anything if a
+// reachable index or manifest cannot be parsed.
+//
+// GC holds the lock of the image layout, so index.json is not updated
+// while it runs. Blobs are stored without the lock, and referenced from
+// index.json only afterwards, so unreachable blobs are only removed once
+// they are older than opts.MinAge.
+func (l *Layout) GC(opts GCOptions) (GCReport, error) {
+	var report GCReport
+
+	minAge := opts.MinAge
+	if minAge == 0 {
+		minAge = DefaultGCMinAge
+	}
+	cutoff := time.Now().Add(-minAge)
+
+	unlock, err := l.Lock()
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	index, err := l.Index()
+	if err != nil {
+		return report, err
+	}
+
+	marked := map[digest.Digest]bool{}
+	if err := l.mark(index.Manifests, marked); err != nil {
+		return report, err
+	}
+
+	dirs, err := ioutil.ReadDir(filepath.Join(l.root, BlobsDir))
+	if err != nil {
+		return report, errors.Wrapf(err, "image layout %s", l.root)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(l.root, BlobsDir, dir.Name()))
+		if err != nil {
+			return report, errors.Wrapf(err, "image layout %s", l.root)
+		}
+		for _, fi := range files {
+			if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(dir.Name()), fi.Name())
+			if marked[dgst] || fi.ModTime().After(cutoff) {
+				continue
+			}
+
+			if !opts.DryRun {
+				err := os.Remove(filepath.Join(l.root, BlobsDir, dir.Name(), fi.Name()))
+				if err != nil && !os.IsNotExist(err) {
+					return report, errors.Wrapf(err, "image layout %s: unable to remove blob %s", l.root, dgst)
+				}
+			}
+			report.Removed = append(report.Removed, dgst)
+			report.Reclaimed += fi.Size()
+		}
+	}
+
+	sort.Sort(digests(report.Removed))
+	return report, nil
+}
+
+// digests sorts digests lexically.
+type digests []digest.Digest
+
+func (d digests) Len() int           { return len(d) }
+func (d digests) Less(i, j int) bool { return d[i] < d[j] }
+func (d digests) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// mark adds the digests of all blobs reachable from descs to marked.
+func (l *Layout) mark(descs []v1.Descriptor, marked map[digest.Digest]bool) error {
+	for _, desc := range descs {
+		if marked[desc.Digest] {
+			continue
+		}
+		marked[desc.Digest] = true
+
+		children, err := l.children(desc)
+		if os.IsNotExist(errors.Cause(err)) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := l.mark(children, marked); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// children returns the descriptors referenced by the image index or
+// manifest desc refers to. Other blobs have no children.
+// If the blob is missing, the error satisfies os.IsNotExist.
+func (l *Layout) children(desc v1.Descriptor) ([]v1.Descriptor, error) {
+	switch desc.MediaType {
+	case v1.MediaTypeImageManifest:
+		var manifest v1.Manifest
+		if err := l.readJSON(desc, &manifest); err != nil {
+			return nil, err
+		}
+		return append([]v1.Descriptor{manifest.Config}, manifest.Layers...), nil
+	case v1.MediaTypeImageIndex:
+		var index v1.Index
+		if err := l.readJSON(desc, &index); err != nil {
+			return nil, err
+		}
+		return index.Manifests, nil
+	}
+	return nil, nil
+}
+
+// readJSON decodes the blob desc refers to into v,
+// after verifying it against desc.
+func (l *Layout) readJSON(desc v1.Descriptor, v interface{}) error {
+	rc, err := l.Fetch(desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	buf, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to read blob %s", l.root, desc.Digest)
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to parse blob %s", l.root, desc.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// blobsOf returns the digests of the manifest desc and of its config and layers.
+func blobsOf(t *testing.T, l *layout.Layout, desc v1.Descriptor) []digest.Digest {
+	rc, err := l.Get(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var manifest v1.Manifest
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	dgsts := []digest.Digest{desc.Digest, manifest.Config.Digest}
+	for _, layer := range manifest.Layers {
+		dgsts = append(dgsts, layer.Digest)
+	}
+	return dgsts
+}
+
+func TestGC(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	// a is referenced directly, b through a nested index, c and the
+	// unreferenced blob are garbage
+	a := putImage(t, l, "a", linuxAmd64)
+	b := putImage(t, l, "b", linuxAmd64)
+	c := putImage(t, l, "c", linuxAmd64)
+	garbage := putBlob(t, l, "application/octet-stream", []byte("garbage"))
+	inner := putJSON(t, l, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{b},
+	})
+	outer := putJSON(t, l, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{inner},
+	})
+	for _, desc := range []v1.Descriptor{a, outer} {
+		if err := l.AddDescriptor(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var expected []string
+	var reclaimed int64
+	for _, dgst := range append(blobsOf(t, l, c), garbage.Digest) {
+		size, err := l.Stat(dgst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, dgst.String())
+		reclaimed += size
+	}
+	sort.Strings(expected)
+
+	for _, dryRun := range []bool{true, false} {
+		report, err := l.GC(layout.GCOptions{DryRun: dryRun, MinAge: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var removed []string
+		for _, dgst := range report.Removed {
+			removed = append(removed, dgst.String())
+		}
+		if !reflect.DeepEqual(removed, expected) {
+			t.Errorf("dry run %t: expected removed blobs %v but got %v", dryRun, expected, removed)
+		}
+		if report.Reclaimed != reclaimed {
+			t.Errorf("dry run %t: expected %d reclaimed bytes but got %d", dryRun, reclaimed, report.Reclaimed)
+		}
+
+		_, err = l.Stat(garbage.Digest)
+		if exists := err == nil; exists != dryRun {
+			t.Errorf("dry run %t: unexpected state of the unreferenced blob: %v", dryRun, err)
+		}
+	}
+
+	for _, dgst := range append(blobsOf(t, l, a), append(blobsOf(t, l, b), inner.Digest, outer.Digest)...) {
+		if _, err := l.Stat(dgst); err != nil {
+			t.Errorf("reachable blob %s was removed: %v", dgst, err)
+		}
+	}
+	if _, err := l.Fsck(schema.Options{}); err != nil {
+		t.Errorf("layout is not consistent after GC: %v", err)
+	}
+
+	report, err := l.GC(layout.GCOptions{MinAge: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 0 {
+		t.Errorf("expected nothing to remove but got %v", report.Removed)
+	}
+}
+
+func TestGCMinAge(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	// a parallel writer has ingested but not yet referenced recent
+	recent := putBlob(t, l, "application/octet-stream", []byte("recent"))
+	old := putBlob(t, l, "application/octet-stream", []byte("old"))
+	path, err := l.BlobPath(old.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-2 * layout.DefaultGCMinAge)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := l.GC(layout.GCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []digest.Digest{old.Digest}; !reflect.DeepEqual(report.Removed, expected) {
+		t.Errorf("expected removed blobs %v but got %v", expected, report.Removed)
+	}
+	if _, err := l.Stat(recent.Digest); err != nil {
+		t.Errorf("the recent blob was removed: %v", err)
+	}
+
+	report, err = l.GC(layout.GCOptions{MinAge: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []digest.Digest{recent.Digest}; !reflect.DeepEqual(report.Removed, expected) {
+		t.Errorf("expected removed blobs %v but got %v", expected, report.Removed)
+	}
+}
+
+func TestGCUnparseable(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	garbage := putBlob(t, l, "application/octet-stream", []byte("garbage"))
+	if err := l.AddDescriptor(putBlob(t, l, v1.MediaTypeImageManifest, []byte("{"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.GC(layout.GCOptions{}); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := l.Stat(garbage.Digest); os.IsNotExist(err) {
+		t.Error("expected no blob to be removed")
+	}
+}
+
+func TestGCLock(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	blob := putBlob(t, l, "application/octet-stream", []byte("referenced while GC waits"))
+
+	unlock, err := l.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := l.GC(layout.GCOptions{MinAge: -1})
+		done <- err
+	}()
+
+	// a writer holding the lock references the blob
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Manifests = append(index.Manifests, blob)
+	p, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(l.Path(), layout.IndexFile), p, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Stat(blob.Digest); err != nil {
+		t.Errorf("a blob referenced before GC got the lock was removed: %v", err)
+	}
+}
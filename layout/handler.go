@@ -0,0 +1,255 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var (
+	// repositoryRegexp matches the repository names of the distribution API.
+	repositoryRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+	// tagRegexp matches the tags of the distribution API.
+	tagRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// NewHandler returns a read-only http.Handler serving l through the
+// distribution API:
+//
+//	GET /v2/
+//	GET /v2/<name>/tags/list
+//	GET /v2/<name>/manifests/<reference>
+//	GET /v2/<name>/blobs/<digest>
+//
+// HEAD requests are served as well. The image layout is served as every
+// repository name. The tags are the ref names of index.json which are
+// valid tags, see Refs. Manifests are also found by the digest of an image
+// manifest or image index reachable from index.json. Manifests are served
+// with the media type of their descriptor and blobs as
+// application/octet-stream, both with a Docker-Content-Digest header.
+// Tags carried by descriptors of different manifests are ambiguous and
+// fail with 409 Conflict.
+func NewHandler(l *Layout) http.Handler {
+	return &handler{layout: l}
+}
+
+type handler struct {
+	layout *Layout
+}
+
+// registryError is an entry of the errors returned by the distribution API.
+type registryError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.fail(w, r, registryError{status: http.StatusMethodNotAllowed, Code: "UNSUPPORTED", Message: "the image layout is read-only"})
+		return
+	}
+
+	if r.URL.Path == "/v2/" || r.URL.Path == "/v2" {
+		h.writeJSON(w, r, struct{}{})
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/v2/") || len(parts) < 3 {
+		h.fail(w, r, registryError{status: http.StatusNotFound, Code: "NOT_FOUND", Message: "unknown endpoint"})
+		return
+	}
+
+	name := strings.Join(parts[:len(parts)-2], "/")
+	kind, ref := parts[len(parts)-2], parts[len(parts)-1]
+	if !repositoryRegexp.MatchString(name) {
+		h.fail(w, r, registryError{status: http.StatusNotFound, Code: "NAME_INVALID", Message: "invalid repository name"})
+		return
+	}
+
+	var err *registryError
+	switch kind {
+	case "tags":
+		if ref != "list" {
+			err = &registryError{status: http.StatusNotFound, Code: "NOT_FOUND", Message: "unknown endpoint"}
+			break
+		}
+		err = h.serveTags(w, r, name)
+	case "manifests":
+		err = h.serveManifest(w, r, ref)
+	case "blobs":
+		err = h.serveBlob(w, r, ref)
+	default:
+		err = &registryError{status: http.StatusNotFound, Code: "NOT_FOUND", Message: "unknown endpoint"}
+	}
+	if err != nil {
+		h.fail(w, r, *err)
+	}
+}
+
+func (h *handler) serveTags(w http.ResponseWriter, r *http.Request, name string) *registryError {
+	names, err := h.layout.Refs()
+	if err != nil {
+		return internalError(err)
+	}
+	tags := []string{}
+	for _, n := range names {
+		if tagRegexp.MatchString(n) {
+			tags = append(tags, n)
+		}
+	}
+	h.writeJSON(w, r, struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}{name, tags})
+	return nil
+}
+
+func (h *handler) serveManifest(w http.ResponseWriter, r *http.Request, ref string) *registryError {
+	var (
+		desc v1.Descriptor
+		err  error
+	)
+	switch {
+	case strings.Contains(ref, ":"):
+		dgst := digest.Digest(ref)
+		if dgst.Validate() != nil {
+			return &registryError{status: http.StatusBadRequest, Code: "DIGEST_INVALID", Message: "invalid digest"}
+		}
+		desc, err = h.layout.findManifest(dgst)
+	case tagRegexp.MatchString(ref):
+		desc, err = h.layout.Resolve(ref, nil)
+	default:
+		return &registryError{status: http.StatusBadRequest, Code: "TAG_INVALID", Message: "invalid tag"}
+	}
+	unknown := registryError{status: http.StatusNotFound, Code: "MANIFEST_UNKNOWN", Message: "manifest unknown"}
+	if errors.Cause(err) == ErrRefNotFound {
+		return &unknown
+	}
+	if _, ok := errors.Cause(err).(RefConflictError); ok {
+		return &registryError{status: http.StatusConflict, Code: "TAG_INVALID", Message: "tag refers to several manifests"}
+	}
+	if err != nil {
+		return internalError(err)
+	}
+	return h.serveContent(w, r, desc.MediaType, desc.Digest, unknown)
+}
+
+func (h *handler) serveBlob(w http.ResponseWriter, r *http.Request, ref string) *registryError {
+	dgst := digest.Digest(ref)
+	if dgst.Validate() != nil {
+		return &registryError{status: http.StatusBadRequest, Code: "DIGEST_INVALID", Message: "invalid digest"}
+	}
+	return h.serveContent(w, r, "application/octet-stream", dgst, registryError{status: http.StatusNotFound, Code: "BLOB_UNKNOWN", Message: "blob unknown"})
+}
+
+// serveContent serves the blob dgst with the given media type, or fails
+// with unknown if it is missing. Range and conditional requests are
+// handled by http.ServeContent.
+func (h *handler) serveContent(w http.ResponseWriter, r *http.Request, mediaType string, dgst digest.Digest, unknown registryError) *registryError {
+	path, err := h.layout.BlobPath(dgst)
+	if err != nil {
+		return internalError(err)
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &unknown
+	}
+	if err != nil {
+		return internalError(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return internalError(err)
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.Header().Set("Etag", `"`+dgst.String()+`"`)
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+	return nil
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == "HEAD" {
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, e registryError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	if r.Method == "HEAD" {
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Errors []registryError `json:"errors"`
+	}{[]registryError{e}})
+}
+
+func internalError(err error) *registryError {
+	return &registryError{status: http.StatusInternalServerError, Code: "UNKNOWN", Message: err.Error()}
+}
+
+// findManifest returns the descriptor of the image manifest or image index
+// with the given digest which is reachable from index.json.
+func (l *Layout) findManifest(dgst digest.Digest) (v1.Descriptor, error) {
+	index, err := l.Index()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	seen := map[digest.Digest]bool{}
+	queue := index.Manifests
+	for len(queue) > 0 {
+		desc := queue[0]
+		queue = queue[1:]
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+
+		if desc.MediaType != v1.MediaTypeImageManifest && desc.MediaType != v1.MediaTypeImageIndex {
+			continue
+		}
+		if desc.Digest == dgst {
+			return desc, nil
+		}
+		if desc.MediaType == v1.MediaTypeImageIndex {
+			var index v1.Index
+			if err := l.readJSON(desc, &index); err != nil {
+				return v1.Descriptor{}, err
+			}
+			queue = append(queue, index.Manifests...)
+		}
+	}
+	return v1.Descriptor{}, errors.Wrapf(ErrRefNotFound, "manifest %s", dgst)
+}
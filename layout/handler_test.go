@@ -0,0 +1,133 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestHandler(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	manifest := putImage(t, l, "a", linuxAmd64)
+	index := putJSON(t, l, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{manifest},
+	})
+	layer := putBlob(t, l, v1.MediaTypeImageLayer, []byte("layer"))
+	for name, desc := range map[string]v1.Descriptor{
+		"latest":         index,
+		"example.com/v1": manifest,
+	} {
+		if err := l.Tag(name, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// conflict is carried by two descriptors, missing by a missing blob
+	unknown := digest.FromString("unknown")
+	for _, desc := range []v1.Descriptor{manifest, index} {
+		desc.Annotations = map[string]string{v1.AnnotationRefName: "conflict"}
+		if err := l.AddDescriptor(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Tag("missing", v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: unknown, Size: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(layout.NewHandler(l))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		method    string
+		path      string
+		status    int
+		mediaType string
+		digest    digest.Digest
+		body      string
+	}{
+		{method: "GET", path: "/v2/", status: 200, mediaType: "application/json", body: "{}"},
+		{method: "GET", path: "/v2/library/image/tags/list", status: 200, mediaType: "application/json", body: `"tags":["conflict","latest","missing"]`},
+		{method: "GET", path: "/v2/image/manifests/latest", status: 200, mediaType: v1.MediaTypeImageIndex, digest: index.Digest},
+		{method: "HEAD", path: "/v2/image/manifests/latest", status: 200, mediaType: v1.MediaTypeImageIndex, digest: index.Digest},
+		{method: "GET", path: "/v2/image/manifests/" + manifest.Digest.String(), status: 200, mediaType: v1.MediaTypeImageManifest, digest: manifest.Digest},
+		{method: "GET", path: "/v2/image/manifests/" + layer.Digest.String(), status: 404, body: "MANIFEST_UNKNOWN"},
+		{method: "GET", path: "/v2/image/manifests/unknown", status: 404, body: "MANIFEST_UNKNOWN"},
+		{method: "GET", path: "/v2/image/manifests/missing", status: 404, body: "MANIFEST_UNKNOWN"},
+		{method: "GET", path: "/v2/image/manifests/conflict", status: 409, body: `"message":"tag refers to several manifests"`},
+		{method: "GET", path: "/v2/image/manifests/sha256:invalid", status: 400, body: "DIGEST_INVALID"},
+		{method: "GET", path: "/v2/image/blobs/" + layer.Digest.String(), status: 200, mediaType: "application/octet-stream", digest: layer.Digest, body: "layer"},
+		{method: "GET", path: "/v2/image/blobs/" + unknown.String(), status: 404, body: "BLOB_UNKNOWN"},
+		{method: "GET", path: "/v2/Image/blobs/" + layer.Digest.String(), status: 404, body: "NAME_INVALID"},
+		{method: "GET", path: "/v2/image/uploads/", status: 404, body: "NOT_FOUND"},
+		{method: "PUT", path: "/v2/image/manifests/latest", status: 405, body: "UNSUPPORTED"},
+	} {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d: %s", tt.status, resp.StatusCode, body)
+			}
+			if tt.mediaType != "" && resp.Header.Get("Content-Type") != tt.mediaType {
+				t.Errorf("expected media type %s but got %s", tt.mediaType, resp.Header.Get("Content-Type"))
+			}
+			if tt.digest != "" {
+				if resp.Header.Get("Docker-Content-Digest") != tt.digest.String() {
+					t.Errorf("expected digest %s but got %s", tt.digest, resp.Header.Get("Docker-Content-Digest"))
+				}
+				size, err := l.Stat(tt.digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.Header.Get("Content-Length") != strconv.FormatInt(size, 10) {
+					t.Errorf("expected length %d but got %s", size, resp.Header.Get("Content-Length"))
+				}
+				if tt.method == "GET" && digest.FromBytes(body) != tt.digest {
+					t.Errorf("unexpected content %q", body)
+				}
+			}
+			if tt.method == "HEAD" && len(body) != 0 {
+				t.Errorf("unexpected body %q", body)
+			}
+			if !strings.Contains(string(body), tt.body) {
+				t.Errorf("expected body %q to contain %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package layout implements access to OCI image layout directories,
+// as described in image-layout.md.
+package layout
+
+import (
+	"bytes"
+	_ "crypto/sha256" // side-effect to install impls, sha256
+	_ "crypto/sha512" // side-effect to install impls, sha384/sh512
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// IndexFile is the file name of the image index of an image layout.
+	IndexFile = "index.json"
+
+	// BlobsDir is the name of the directory holding the blobs of an image layout.
+	BlobsDir = "blobs"
+)
+
+// Layout is an image layout directory.
+// It implements schema.BlobProvider.
+type Layout struct {
+	root string
+}
+
+// Open opens the image layout directory at path. The oci-layout file
+// must be valid against schema.ValidatorMediaTypeLayoutHeader and hold
+// v1.ImageLayoutVersion.
+func Open(path string) (*Layout, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open image layout")
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("image layout %s is not a directory", path)
+	}
+
+	l := &Layout{root: path}
+	if err := l.checkHeader(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// checkHeader validates the oci-layout file of l.
+func (l *Layout) checkHeader() error {
+	buf, err := ioutil.ReadFile(filepath.Join(l.root, v1.ImageLayoutFile))
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s", l.root)
+	}
+	return errors.Wrapf(checkHeader(buf), "image layout %s", l.root)
+}
+
+// Path returns the path of the image layout directory.
+func (l *Layout) Path() string {
+	return l.root
+}
+
+// Index reads and validates the index.json file of the image layout.
+func (l *Layout) Index() (v1.Index, error) {
+	index, _, err := l.IndexWithDigest()
+	return index, err
+}
+
+// IndexWithDigest is like Index, but also returns the digest of index.json,
+// for use with CompareAndSwapIndex.
+func (l *Layout) IndexWithDigest() (v1.Index, digest.Digest, error) {
+	var index v1.Index
+	buf, err := ioutil.ReadFile(filepath.Join(l.root, IndexFile))
+	if err != nil {
+		return index, "", errors.Wrapf(err, "image layout %s", l.root)
+	}
+
+	if err := schema.ValidatorMediaTypeImageIndex.Validate(bytes.NewReader(buf)); err != nil {
+		return index, "", errors.Wrapf(err, "image layout %s: invalid %s file", l.root, IndexFile)
+	}
+	if err := json.Unmarshal(buf, &index); err != nil {
+		return index, "", errors.Wrapf(err, "image layout %s: invalid %s file", l.root, IndexFile)
+	}
+	return index, digest.FromBytes(buf), nil
+}
+
+// BlobPath returns the path of the blob with the given digest,
+// blobs/<alg>/<encoded> below the image layout directory.
+// The blob does not need to exist.
+func (l *Layout) BlobPath(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", errors.Wrapf(err, "invalid digest %q", dgst)
+	}
+	return filepath.Join(l.root, BlobsDir, dgst.Algorithm().String(), dgst.Encoded()), nil
+}
+
+// Get returns a reader for the content of the blob with the given digest.
+// If the blob does not exist, the error satisfies os.IsNotExist.
+func (l *Layout) Get(dgst digest.Digest) (io.ReadCloser, error) {
+	path, err := l.BlobPath(dgst)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Fetch returns a reader for the content of the blob desc refers to,
+// which is verified against desc while it is read, see
+// identity.NewVerifiedReader. If the blob does not exist,
+// the error satisfies os.IsNotExist.
+func (l *Layout) Fetch(desc v1.Descriptor) (io.ReadCloser, error) {
+	rc, err := l.Get(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	r, err := identity.NewVerifiedReader(rc, desc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
+}
+
+// Stat returns the size of the blob with the given digest.
+// If the blob does not exist, the error satisfies os.IsNotExist.
+func (l *Layout) Stat(dgst digest.Digest) (int64, error) {
+	path, err := l.BlobPath(dgst)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ schema.BlobProvider = &layout.Layout{}
+
+// writeFiles creates a directory holding the given files and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "layout-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const (
+	testHeader = `{"imageLayoutVersion": "1.0.0"}`
+	testBlob   = "hello"
+)
+
+var testDigest = digest.FromString(testBlob)
+
+func testLayout(t *testing.T) string {
+	return writeFiles(t, map[string]string{
+		v1.ImageLayoutFile:                     testHeader,
+		layout.IndexFile:                       `{"schemaVersion": 2, "manifests": [{"mediaType": "application/vnd.oci.image.manifest.v1+json", "size": 5, "digest": "` + testDigest.String() + `"}]}`,
+		"blobs/sha256/" + testDigest.Encoded(): testBlob,
+	})
+}
+
+func TestOpen(t *testing.T) {
+	for i, tt := range []struct {
+		files map[string]string
+		fail  bool
+	}{
+		{files: map[string]string{v1.ImageLayoutFile: testHeader}},
+
+		// expected failure: oci-layout missing
+		{files: map[string]string{layout.IndexFile: `{"schemaVersion": 2, "manifests": []}`}, fail: true},
+
+		// expected failure: oci-layout is not valid against the schema
+		{files: map[string]string{v1.ImageLayoutFile: `{"imageLayoutVersion": 1}`}, fail: true},
+
+		// expected failure: unsupported version
+		{files: map[string]string{v1.ImageLayoutFile: `{"imageLayoutVersion": "2.0.0"}`}, fail: true},
+	} {
+		dir := writeFiles(t, tt.files)
+		defer os.RemoveAll(dir)
+
+		_, err := layout.Open(dir)
+		if got := err != nil; got != tt.fail {
+			t.Errorf("test %d: expected fail=%t but got %v", i, tt.fail, err)
+		}
+	}
+
+	if _, err := layout.Open(filepath.Join(os.TempDir(), "layout-test-missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := testLayout(t)
+	defer os.RemoveAll(dir)
+
+	l, err := layout.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Path() != dir {
+		t.Errorf("expected path %s but got %s", dir, l.Path())
+	}
+
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != testDigest {
+		t.Errorf("unexpected index %+v", index)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, layout.IndexFile), []byte(`{"manifests": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Index(); err == nil {
+		t.Error("expected an error for an invalid index")
+	}
+}
+
+func TestGet(t *testing.T) {
+	dir := testLayout(t)
+	defer os.RemoveAll(dir)
+
+	l, err := layout.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := l.Get(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != testBlob {
+		t.Errorf("expected %q but got %q", testBlob, p)
+	}
+
+	if size, err := l.Stat(testDigest); err != nil || size != int64(len(testBlob)) {
+		t.Errorf("expected size %d but got %d, %v", len(testBlob), size, err)
+	}
+
+	if _, err := l.Get(digest.FromString("missing")); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error but got %v", err)
+	}
+	if _, err := l.Get("sha256:../../oci-layout"); err == nil || os.IsNotExist(err) {
+		t.Errorf("expected an invalid digest error but got %v", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	dir := testLayout(t)
+	defer os.RemoveAll(dir)
+
+	l, err := layout.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := int64(len(testBlob))
+	for _, tt := range []struct {
+		desc     v1.Descriptor
+		expected error
+	}{
+		{v1.Descriptor{Digest: testDigest, Size: size}, nil},
+		{v1.Descriptor{Digest: testDigest, Size: size - 1}, identity.SizeExceededError{Digest: testDigest, Size: size - 1}},
+		{v1.Descriptor{Digest: testDigest, Size: size + 1}, identity.SizeMismatchError{Digest: testDigest, Size: size + 1, Actual: size}},
+	} {
+		rc, err := l.Fetch(tt.desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != tt.expected {
+			t.Errorf("%+v: expected error %v but got %v", tt.desc, tt.expected, err)
+		}
+	}
+
+	if _, err := l.Fetch(v1.Descriptor{Digest: digest.FromString("missing")}); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error but got %v", err)
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	dir := testLayout(t)
+	defer os.RemoveAll(dir)
+
+	l, err := layout.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := v1.Descriptor{MediaType: "application/octet-stream", Digest: testDigest, Size: int64(len(testBlob))}
+	if _, err := schema.ValidateContent(desc, l, schema.Options{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LockFile is the name of the file locked by Lock,
+// in the image layout directory.
+const LockFile = ".lock"
+
+// Lock acquires the advisory lock of the image layout, waiting until it is
+// available, and returns a function releasing it. The lock is held by the
+// methods updating index.json, so writers in several processes, or using
+// several Layout values, do not overwrite each other's changes. GC and
+// Pack hold it as well, so blobs are not removed while index.json is
+// updated or packed.
+//
+// The lock is not reentrant: the methods holding it must not be called
+// while holding it. On platforms without flock(2), Lock does nothing
+// and updates rely on CompareAndSwapIndex alone.
+func (l *Layout) Lock() (unlock func() error, err error) {
+	f, err := os.OpenFile(filepath.Join(l.root, LockFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "image layout %s: unable to open lock file", l.root)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "image layout %s: unable to lock", l.root)
+	}
+
+	return func() error {
+		err := unlockFile(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
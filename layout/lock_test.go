@@ -0,0 +1,177 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestConcurrentTag(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	const writers = 16
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// every writer uses its own Layout, like separate processes
+			w, err := layout.Open(l.Path())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			desc := v1.Descriptor{
+				MediaType: v1.MediaTypeImageManifest,
+				Digest:    digest.FromString(fmt.Sprint(i)),
+				Size:      1,
+			}
+			if err := w.Tag(fmt.Sprintf("v%d", i), desc); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	refs, err := l.Refs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != writers {
+		t.Errorf("expected %d refs but got %v", writers, refs)
+	}
+}
+
+func TestCompareAndSwapIndex(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	index, dgst, err := l.IndexWithDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("a"), Size: 1}
+	if err := l.AddDescriptor(desc); err != nil {
+		t.Fatal(err)
+	}
+
+	index.Manifests = append(index.Manifests, v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("b"), Size: 1})
+	if err := l.CompareAndSwapIndex(dgst, index); errors.Cause(err) != layout.ErrIndexChanged {
+		t.Fatalf("expected ErrIndexChanged but got %v", err)
+	}
+
+	index, dgst, err = l.IndexWithDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != desc.Digest {
+		t.Fatalf("expected the index to be unchanged but got %+v", index)
+	}
+	index.Manifests = nil
+	if err := l.CompareAndSwapIndex(dgst, index); err != nil {
+		t.Fatal(err)
+	}
+	if index, err := l.Index(); err != nil || len(index.Manifests) != 0 {
+		t.Errorf("expected an empty index but got %+v, %v", index, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	unlock, err := l.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.AddDescriptor(v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("a"), Size: 1})
+	}()
+
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 0 {
+		t.Error("index.json was updated while the lock was held")
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackLock(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	unlock, err := l.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	done := make(chan error)
+	go func() {
+		done <- l.Pack(buf)
+	}()
+
+	// a writer holding the lock updates index.json,
+	// after Pack had the chance to read the old one
+	time.Sleep(50 * time.Millisecond)
+	index := `{"schemaVersion":2,"manifests":[],"annotations":{"updated":"true"}}`
+	if err := ioutil.WriteFile(filepath.Join(l.Path(), layout.IndexFile), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == layout.IndexFile {
+			if p := readAll(t, tr); string(p) != index {
+				t.Errorf("expected the updated index.json but got %s", p)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/ebnf"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ErrRefNotFound is the cause of the errors returned for unknown ref names.
+var ErrRefNotFound = errors.New("ref not found")
+
+// RefConflictError is returned when a ref name resolves to more than one
+// descriptor, either because several descriptors of index.json carry the
+// name or because several manifests match the requested platform.
+type RefConflictError struct {
+	Name        string
+	Descriptors []v1.Descriptor
+}
+
+func (e RefConflictError) Error() string {
+	dgsts := make([]string, 0, len(e.Descriptors))
+	for _, desc := range e.Descriptors {
+		dgsts = append(dgsts, desc.Digest.String())
+	}
+	return fmt.Sprintf("ref %q is ambiguous, it resolves to %s", e.Name, strings.Join(dgsts, ", "))
+}
+
+// refGrammar is the grammar of ref names given in annotations.md.
+const refGrammar = `
+ref       ::= component ("/" component)*
+component ::= alphanum (separator alphanum)*
+alphanum  ::= [A-Za-z0-9]+
+separator ::= [-._:@+] | "--"
+`
+
+var refRegexp = compileRefGrammar()
+
+func compileRefGrammar() *regexp.Regexp {
+	g, err := ebnf.Parse(strings.NewReader(refGrammar))
+	if err != nil {
+		panic(err)
+	}
+	re, err := g.Regexp("ref")
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// refName returns a Matcher selecting the descriptors named name.
+func refName(name string) Matcher {
+	return func(desc v1.Descriptor) bool {
+		return desc.Annotations[v1.AnnotationRefName] == name
+	}
+}
+
+// Refs returns the sorted ref names of the descriptors of index.json.
+// Names carried by more than one descriptor are listed once.
+func (l *Layout) Refs() ([]string, error) {
+	index, err := l.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, desc := range index.Manifests {
+		name, ok := desc.Annotations[v1.AnnotationRefName]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Resolve returns the descriptor of index.json named name.
+//
+// If platform is not nil, Resolve descends into image indexes and returns
+// the image manifest for platform. A manifest matches if its OS and
+// architecture are equal to those of platform, as well as the variant,
+// OS version and OS features requested by platform. The platform of
+// manifest descriptors without one is taken from the image configuration.
+//
+// Several descriptors may carry the same name. If they all resolve to the
+// same digest, the first of them is returned. Otherwise, Resolve fails
+// with a RefConflictError. Unknown names fail with ErrRefNotFound.
+func (l *Layout) Resolve(name string, platform *v1.Platform) (v1.Descriptor, error) {
+	index, err := l.Index()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	var candidates []v1.Descriptor
+	for _, desc := range index.Manifests {
+		if refName(name)(desc) {
+			candidates = append(candidates, desc)
+		}
+	}
+	if len(candidates) == 0 {
+		return v1.Descriptor{}, errors.Wrapf(ErrRefNotFound, "ref %q", name)
+	}
+
+	if platform != nil {
+		var matches []v1.Descriptor
+		for _, desc := range candidates {
+			m, err := l.matchPlatform(desc, platform)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			matches = append(matches, m...)
+		}
+		if len(matches) == 0 {
+			return v1.Descriptor{}, errors.Wrapf(ErrRefNotFound, "ref %q for platform %s/%s", name, platform.OS, platform.Architecture)
+		}
+		candidates = matches
+	}
+
+	unique := uniqueDigests(candidates)
+	if len(unique) > 1 {
+		return v1.Descriptor{}, RefConflictError{Name: name, Descriptors: unique}
+	}
+	return unique[0], nil
+}
+
+// uniqueDigests returns the first of the descriptors for every digest.
+func uniqueDigests(descs []v1.Descriptor) []v1.Descriptor {
+	seen := map[digest.Digest]bool{}
+	var unique []v1.Descriptor
+	for _, desc := range descs {
+		if !seen[desc.Digest] {
+			seen[desc.Digest] = true
+			unique = append(unique, desc)
+		}
+	}
+	return unique
+}
+
+// matchPlatform returns the image manifests below desc which match platform.
+func (l *Layout) matchPlatform(desc v1.Descriptor, platform *v1.Platform) ([]v1.Descriptor, error) {
+	switch desc.MediaType {
+	case v1.MediaTypeImageIndex:
+		var index v1.Index
+		if err := l.readJSON(desc, &index); err != nil {
+			return nil, err
+		}
+		var matches []v1.Descriptor
+		for _, m := range index.Manifests {
+			found, err := l.matchPlatform(m, platform)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, found...)
+		}
+		return matches, nil
+	case v1.MediaTypeImageManifest:
+		have := desc.Platform
+		if have == nil {
+			var manifest v1.Manifest
+			if err := l.readJSON(desc, &manifest); err != nil {
+				return nil, err
+			}
+			var config v1.Image
+			if err := l.readJSON(manifest.Config, &config); err != nil {
+				return nil, err
+			}
+			have = &v1.Platform{OS: config.OS, Architecture: config.Architecture}
+		}
+		if platformMatches(platform, have) {
+			return []v1.Descriptor{desc}, nil
+		}
+	}
+	return nil, nil
+}
+
+// platformMatches reports whether the platform have satisfies want.
+func platformMatches(want, have *v1.Platform) bool {
+	if want.OS != have.OS || want.Architecture != have.Architecture {
+		return false
+	}
+	if want.Variant != "" && want.Variant != have.Variant {
+		return false
+	}
+	if want.OSVersion != "" && want.OSVersion != have.OSVersion {
+		return false
+	}
+	for _, feature := range want.OSFeatures {
+		found := false
+		for _, f := range have.OSFeatures {
+			found = found || f == feature
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Tag names desc name in index.json. The name must match the ref grammar
+// of annotations.md. Descriptors already carrying the name are replaced,
+// so afterwards the name is carried by desc only.
+func (l *Layout) Tag(name string, desc v1.Descriptor) error {
+	if !refRegexp.MatchString(name) {
+		return errors.Errorf("invalid ref name %q", name)
+	}
+
+	annotations := map[string]string{}
+	for k, v := range desc.Annotations {
+		annotations[k] = v
+	}
+	annotations[v1.AnnotationRefName] = name
+	desc.Annotations = annotations
+
+	return l.ReplaceDescriptor(refName(name), desc)
+}
+
+// Untag removes the descriptors named name from index.json.
+// Their blobs are left for GC. Unknown names fail with ErrRefNotFound.
+func (l *Layout) Untag(name string) error {
+	n, err := l.RemoveDescriptors(refName(name))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.Wrapf(ErrRefNotFound, "ref %q", name)
+	}
+	return nil
+}
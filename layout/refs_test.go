@@ -0,0 +1,136 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestRefs(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	linuxArm := v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	amd64 := putImage(t, l, "amd64", linuxAmd64)
+	arm := putImage(t, l, "arm", linuxArm)
+	noPlatform := putImage(t, l, "none", linuxAmd64)
+	noPlatform.Platform = nil
+	index := putJSON(t, l, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{amd64, arm},
+	})
+
+	for name, desc := range map[string]v1.Descriptor{
+		"v1.0":   index,
+		"amd64":  amd64,
+		"config": noPlatform,
+	} {
+		if err := l.Tag(name, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a second descriptor with the same name, added without Tag
+	dup := arm
+	dup.Annotations = map[string]string{v1.AnnotationRefName: "dup"}
+	dupAmd64 := amd64
+	dupAmd64.Annotations = map[string]string{v1.AnnotationRefName: "dup"}
+	for _, desc := range []v1.Descriptor{dup, dupAmd64} {
+		if err := l.AddDescriptor(desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := l.Refs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"amd64", "config", "dup", "v1.0"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected refs %v but got %v", expected, names)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		platform *v1.Platform
+		expected v1.Descriptor
+		err      string
+	}{
+		{name: "v1.0", expected: index},
+		{name: "v1.0", platform: &linuxAmd64, expected: amd64},
+		{name: "v1.0", platform: &linuxArm, expected: arm},
+		{name: "v1.0", platform: &v1.Platform{OS: "linux", Architecture: "arm"}, expected: arm},
+		{name: "v1.0", platform: &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, err: "not found"},
+		{name: "amd64", platform: &linuxAmd64, expected: amd64},
+		{name: "config", platform: &linuxAmd64, expected: noPlatform},
+		{name: "config", platform: &linuxArm, err: "not found"},
+		{name: "dup", err: "conflict"},
+		{name: "dup", platform: &linuxArm, expected: arm},
+		{name: "missing", err: "not found"},
+	} {
+		desc, err := l.Resolve(tt.name, tt.platform)
+		switch tt.err {
+		case "":
+			if err != nil {
+				t.Errorf("%s %v: unexpected error: %v", tt.name, tt.platform, err)
+			} else if desc.Digest != tt.expected.Digest {
+				t.Errorf("%s %v: expected %s but got %s", tt.name, tt.platform, tt.expected.Digest, desc.Digest)
+			}
+		case "not found":
+			if errors.Cause(err) != layout.ErrRefNotFound {
+				t.Errorf("%s %v: expected ErrRefNotFound but got %v", tt.name, tt.platform, err)
+			}
+		case "conflict":
+			cerr, ok := errors.Cause(err).(layout.RefConflictError)
+			if !ok || len(cerr.Descriptors) != 2 {
+				t.Errorf("%s %v: expected a conflict between 2 descriptors but got %v", tt.name, tt.platform, err)
+			}
+		}
+	}
+
+	// tagging resolves the conflict
+	if err := l.Tag("dup", amd64); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := l.Resolve("dup", nil); err != nil || desc.Digest != amd64.Digest {
+		t.Errorf("expected %s but got %s, %v", amd64.Digest, desc.Digest, err)
+	}
+
+	if err := l.Untag("dup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Resolve("dup", nil); errors.Cause(err) != layout.ErrRefNotFound {
+		t.Errorf("expected ErrRefNotFound but got %v", err)
+	}
+	if err := l.Untag("dup"); errors.Cause(err) != layout.ErrRefNotFound {
+		t.Errorf("expected ErrRefNotFound but got %v", err)
+	}
+}
+
+func TestTagInvalidName(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	desc := putImage(t, l, "a", linuxAmd64)
+	for _, name := range []string{"", "-v1", "v1/", "a b", "v1---rc"} {
+		if err := l.Tag(name, desc); err == nil {
+			t.Errorf("expected an error for ref name %q", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// UnpackRootFS applies the layers of the image desc refers to, in order,
+// onto the root filesystem directory root, which is created if needed.
+//
+// If desc refers to an image index, the image manifest for platform is
+// unpacked, see Resolve for how platforms match. If desc refers to an
+// image manifest and platform is not nil, the manifest must match it.
+//
+// Every layer is verified against its descriptor and its DiffID against
+// the rootfs.diff_ids of the image configuration. As layers are verified
+// while they are applied, root is left partially unpacked on errors.
+func (l *Layout) UnpackRootFS(desc v1.Descriptor, platform *v1.Platform, root string, opts layer.ApplyOptions) error {
+	desc, err := l.selectManifest(desc, platform)
+	if err != nil {
+		return err
+	}
+
+	var manifest v1.Manifest
+	if err := l.readJSON(desc, &manifest); err != nil {
+		return err
+	}
+	var config v1.Image
+	if err := l.readJSON(manifest.Config, &config); err != nil {
+		return err
+	}
+	diffIDs := config.RootFS.DiffIDs
+	if len(diffIDs) != len(manifest.Layers) {
+		return errors.Errorf("image %s: %d diff_ids do not match the %d layers of the manifest", desc.Digest, len(diffIDs), len(manifest.Layers))
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return errors.Wrap(err, "unable to create the root filesystem")
+	}
+	for i, desc := range manifest.Layers {
+		if alg := diffIDs[i].Algorithm(); alg != digest.Canonical {
+			return errors.Errorf("layer %s: unsupported DiffID algorithm %q", desc.Digest, alg)
+		}
+		if err := l.applyLayer(desc, diffIDs[i], root, opts); err != nil {
+			return errors.Wrapf(err, "layer %s", desc.Digest)
+		}
+	}
+	return nil
+}
+
+// selectManifest returns the descriptor of the image manifest for platform
+// below desc.
+func (l *Layout) selectManifest(desc v1.Descriptor, platform *v1.Platform) (v1.Descriptor, error) {
+	if platform == nil {
+		if desc.MediaType == v1.MediaTypeImageIndex {
+			return v1.Descriptor{}, errors.Errorf("image index %s needs a platform", desc.Digest)
+		}
+	} else {
+		matches, err := l.matchPlatform(desc, platform)
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		unique := uniqueDigests(matches)
+		switch len(unique) {
+		case 0:
+			return v1.Descriptor{}, errors.Errorf("image %s has no manifest for platform %s/%s", desc.Digest, platform.OS, platform.Architecture)
+		case 1:
+			desc = unique[0]
+		default:
+			return v1.Descriptor{}, RefConflictError{Name: desc.Digest.String(), Descriptors: unique}
+		}
+	}
+
+	if desc.MediaType != v1.MediaTypeImageManifest {
+		return v1.Descriptor{}, errors.Errorf("%s is no image manifest but %s", desc.Digest, desc.MediaType)
+	}
+	return desc, nil
+}
+
+// applyLayer applies the layer desc refers to onto root
+// and checks that it has the given DiffID.
+func (l *Layout) applyLayer(desc v1.Descriptor, diffID digest.Digest, root string, opts layer.ApplyOptions) error {
+	rc, err := l.Fetch(desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	actual, err := layer.Apply(root, rc, desc.MediaType, opts)
+	if err != nil {
+		return err
+	}
+	// the verification happens at the end of the blob
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		return err
+	}
+	if actual != diffID {
+		return errors.Errorf("DiffID %s does not match %s of the image configuration", actual, diffID)
+	}
+	return nil
+}
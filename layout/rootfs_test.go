@@ -0,0 +1,169 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// putLayers stores an image with the given layers and returns the
+// descriptors of its manifest and layers. The first layer is stored
+// uncompressed, the others gzip compressed. If diffIDs is nil,
+// the DiffIDs of the layers are used.
+func putLayers(t *testing.T, l *layout.Layout, diffIDs []digest.Digest, layers ...[]byte) (v1.Descriptor, []v1.Descriptor) {
+	if diffIDs == nil {
+		for _, p := range layers {
+			diffIDs = append(diffIDs, digest.FromBytes(p))
+		}
+	}
+
+	var descs []v1.Descriptor
+	for i, p := range layers {
+		if i == 0 {
+			descs = append(descs, putBlob(t, l, v1.MediaTypeImageLayer, p))
+			continue
+		}
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		if _, err := gw.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		descs = append(descs, putBlob(t, l, v1.MediaTypeImageLayerGzip, buf.Bytes()))
+	}
+
+	config := putJSON(t, l, v1.MediaTypeImageConfig, v1.Image{
+		Architecture: linuxAmd64.Architecture,
+		OS:           linuxAmd64.OS,
+		RootFS:       v1.RootFS{Type: "layers", DiffIDs: diffIDs},
+	})
+	manifest := putJSON(t, l, v1.MediaTypeImageManifest, v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    config,
+		Layers:    descs,
+	})
+	return manifest, descs
+}
+
+func readAll(t *testing.T, r io.Reader) []byte {
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUnpackRootFS(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	lower := readAll(t, archive(t, entry{"a", tar.TypeReg, "1"}, entry{"b", tar.TypeReg, "2"}))
+	upper := readAll(t, archive(t, entry{".wh.a", tar.TypeReg, ""}, entry{"c", tar.TypeReg, "3"}))
+	manifest, layers := putLayers(t, l, nil, lower, upper)
+	index := putJSON(t, l, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{manifest},
+	})
+	wrongDiffID, _ := putLayers(t, l, []digest.Digest{digest.FromBytes(upper), digest.FromBytes(upper)}, lower, upper)
+
+	windows := v1.Platform{OS: "windows", Architecture: "amd64"}
+	for _, tt := range []struct {
+		name     string
+		desc     v1.Descriptor
+		platform *v1.Platform
+		setup    func(t *testing.T)
+		fail     bool
+	}{
+		{name: "manifest", desc: manifest},
+		{name: "manifest for platform", desc: manifest, platform: &linuxAmd64},
+		{name: "index for platform", desc: index, platform: &linuxAmd64},
+		{name: "index without platform", desc: index, fail: true},
+		{name: "unknown platform", desc: index, platform: &windows, fail: true},
+		{name: "config", desc: putJSON(t, l, v1.MediaTypeImageConfig, v1.Image{}), fail: true},
+		{name: "DiffID mismatch", desc: wrongDiffID, fail: true},
+		{
+			name: "corrupt layer",
+			desc: manifest,
+			setup: func(t *testing.T) {
+				// a valid layer which does not match the digest
+				path, err := l.BlobPath(layers[0].Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				corrupt := readAll(t, archive(t, entry{"a", tar.TypeReg, "9"}, entry{"b", tar.TypeReg, "2"}))
+				if err := ioutil.WriteFile(path, corrupt, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			fail: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			root, err := ioutil.TempDir("", "rootfs-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			err = l.UnpackRootFS(tt.desc, tt.platform, root, layer.ApplyOptions{IgnoreOwnership: true})
+			if tt.fail {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matches, err := filepath.Glob(filepath.Join(root, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, m := range matches {
+				content, err := ioutil.ReadFile(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, filepath.Base(m)+"="+string(content))
+			}
+			sort.Strings(files)
+			if expected := []string{"b=2", "c=3"}; !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected %q but got %q", expected, files)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/canonical"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Squash squashes the layers start to end-1 of the image manifest desc
+// refers to into a single layer, see layer.Squash, and stores the
+// squashed layer, the rewritten image configuration, see
+// layer.SquashConfig, and the rewritten manifest as blobs. It returns
+// the descriptor of the new manifest, which keeps the platform and
+// annotations of desc. index.json is left unchanged; see Tag.
+//
+// Only the diff_ids and history of the configuration and the config and
+// layers of the manifest are rewritten; all other fields, including the
+// ones the specs-go types do not know about, are kept.
+//
+// The squashed layer is gzip compressed if one of the squashed layers
+// is, and non-distributable if one of them is. The layers are verified
+// against their descriptors while they are read.
+func (l *Layout) Squash(desc v1.Descriptor, start, end int) (v1.Descriptor, error) {
+	if desc.MediaType != v1.MediaTypeImageManifest {
+		return v1.Descriptor{}, errors.Errorf("%s is no image manifest but %s", desc.Digest, desc.MediaType)
+	}
+	var manifest v1.Manifest
+	var manifestFields struct {
+		Config json.RawMessage   `json:"config"`
+		Layers []json.RawMessage `json:"layers"`
+	}
+	rawManifest, err := l.readRawJSON(desc, &manifest, &manifestFields)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	var config v1.Image
+	var configFields struct {
+		RootFS json.RawMessage `json:"rootfs"`
+	}
+	rawConfig, err := l.readRawJSON(manifest.Config, &config, &configFields)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if start < 0 || end > len(manifest.Layers) || start >= end {
+		return v1.Descriptor{}, errors.Errorf("image %s: invalid layer range [%d, %d) of %d layers", desc.Digest, start, end, len(manifest.Layers))
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return v1.Descriptor{}, errors.Errorf("image %s: %d diff_ids do not match the %d layers of the manifest", desc.Digest, len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	squashed, diffID, err := l.squashLayers(manifest.Layers[start:end])
+	if err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image %s", desc.Digest)
+	}
+	config, err = layer.SquashConfig(config, start, end, diffID)
+	if err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image %s", desc.Digest)
+	}
+	rootFS, err := setFields(configFields.RootFS, map[string]interface{}{"diff_ids": config.RootFS.DiffIDs})
+	if err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image %s", desc.Digest)
+	}
+	fields := map[string]interface{}{"rootfs": rootFS}
+	if config.History != nil {
+		fields["history"] = config.History
+	}
+	if rawConfig, err = setFields(rawConfig, fields); err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image %s", desc.Digest)
+	}
+	squashedConfig, err := l.putJSON(manifest.Config.MediaType, rawConfig)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	configDesc, err := setFields(manifestFields.Config, map[string]interface{}{"digest": squashedConfig.Digest, "size": squashedConfig.Size})
+	if err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image %s", desc.Digest)
+	}
+	squashedLayer, err := json.Marshal(squashed)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	layers := append([]json.RawMessage{}, manifestFields.Layers[:start]...)
+	layers = append(layers, squashedLayer)
+	layers = append(layers, manifestFields.Layers[end:]...)
+	if rawManifest, err = setFields(rawManifest, map[string]interface{}{"config": configDesc, "layers": layers}); err != nil {
+		return v1.Descriptor{}, errors.Wrapf(err, "image %s", desc.Digest)
+	}
+	squashedManifest, err := l.putJSON(desc.MediaType, rawManifest)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	squashedManifest.Platform, squashedManifest.Annotations = desc.Platform, desc.Annotations
+	return squashedManifest, nil
+}
+
+// readRawJSON returns the JSON blob desc refers to, after decoding it
+// into each of vs.
+func (l *Layout) readRawJSON(desc v1.Descriptor, vs ...interface{}) (json.RawMessage, error) {
+	var p json.RawMessage
+	if err := l.readJSON(desc, &p); err != nil {
+		return nil, err
+	}
+	for _, v := range vs {
+		if err := json.Unmarshal(p, v); err != nil {
+			return nil, errors.Wrapf(err, "image layout %s: unable to parse blob %s", l.root, desc.Digest)
+		}
+	}
+	return p, nil
+}
+
+// squashLayers stores the squash of layers as a blob and returns its
+// descriptor and DiffID.
+func (l *Layout) squashLayers(layers []v1.Descriptor) (v1.Descriptor, digest.Digest, error) {
+	var srcs []layer.Source
+	gzipped, nonDistributable := false, false
+	for _, desc := range layers {
+		desc := desc
+		srcs = append(srcs, layer.Source{
+			MediaType: desc.MediaType,
+			Open: func() (io.ReadCloser, error) {
+				return l.Fetch(desc)
+			},
+		})
+		switch desc.MediaType {
+		case v1.MediaTypeImageLayerGzip:
+			gzipped = true
+		case v1.MediaTypeImageLayerNonDistributable:
+			nonDistributable = true
+		case v1.MediaTypeImageLayerNonDistributableGzip:
+			gzipped, nonDistributable = true, true
+		}
+	}
+
+	mediaType := v1.MediaTypeImageLayer
+	switch {
+	case gzipped && nonDistributable:
+		mediaType = v1.MediaTypeImageLayerNonDistributableGzip
+	case gzipped:
+		mediaType = v1.MediaTypeImageLayerGzip
+	case nonDistributable:
+		mediaType = v1.MediaTypeImageLayerNonDistributable
+	}
+
+	pr, pw := io.Pipe()
+	type result struct {
+		diffID digest.Digest
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var w io.WriteCloser = pw
+		if gzipped {
+			w = gzip.NewWriter(pw)
+		}
+		diffID, err := layer.Squash(w, srcs)
+		if gzipped && err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+		done <- result{diffID, err}
+	}()
+
+	dgst, size, err := l.PutBlob(pr)
+	if err != nil {
+		// unblock the squash, whose error is a consequence
+		pr.CloseWithError(err)
+		<-done
+		return v1.Descriptor{}, "", err
+	}
+	res := <-done
+	if res.err != nil {
+		return v1.Descriptor{}, "", res.err
+	}
+	return v1.Descriptor{MediaType: mediaType, Digest: dgst, Size: size}, res.diffID, nil
+}
+
+// putJSON stores v in canonical form as a blob
+// and returns its descriptor with the given media type.
+func (l *Layout) putJSON(mediaType string, v interface{}) (v1.Descriptor, error) {
+	p, err := canonical.Marshal(v)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	dgst, size, err := l.PutBlob(bytes.NewReader(p))
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return v1.Descriptor{MediaType: mediaType, Digest: dgst, Size: size}, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layer"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// readJSON decodes the blob desc refers to into v.
+func readJSON(t *testing.T, l *layout.Layout, desc v1.Descriptor, v interface{}) {
+	rc, err := l.Fetch(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if err := json.Unmarshal(readAll(t, rc), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSquash(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	base := readAll(t, archive(t, entry{"a", tar.TypeReg, "1"}))
+	lower := readAll(t, archive(t, entry{"b", tar.TypeReg, "2"}, entry{"c", tar.TypeReg, "3"}))
+	upper := readAll(t, archive(t, entry{".wh.a", tar.TypeReg, ""}, entry{".wh.b", tar.TypeReg, ""}, entry{"d", tar.TypeReg, "4"}))
+	manifest, _ := putLayers(t, l, nil, base, lower, upper)
+	manifest.Annotations = map[string]string{"key": "value"}
+
+	for _, r := range [][2]int{{-1, 1}, {1, 1}, {2, 4}} {
+		if _, err := l.Squash(manifest, r[0], r[1]); err == nil {
+			t.Errorf("expected an error for the range %v", r)
+		}
+	}
+
+	squashed, err := l.Squash(manifest, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if squashed.Digest == manifest.Digest || !reflect.DeepEqual(squashed.Annotations, manifest.Annotations) {
+		t.Errorf("unexpected descriptor %+v", squashed)
+	}
+	if _, err := l.Fsck(schema.Options{}); err != nil {
+		t.Errorf("the squashed image is not consistent: %v", err)
+	}
+
+	var m v1.Manifest
+	readJSON(t, l, squashed, &m)
+	if len(m.Layers) != 2 || m.Layers[1].MediaType != v1.MediaTypeImageLayerGzip {
+		t.Fatalf("expected a gzip compressed squashed layer but got %+v", m.Layers)
+	}
+	var config v1.Image
+	readJSON(t, l, m.Config, &config)
+	if len(config.RootFS.DiffIDs) != 2 {
+		t.Errorf("expected 2 diff_ids but got %v", config.RootFS.DiffIDs)
+	}
+
+	root, err := ioutil.TempDir("", "rootfs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := l.UnpackRootFS(squashed, nil, root, layer.ApplyOptions{IgnoreOwnership: true}); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := filepath.Glob(filepath.Join(root, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, m := range matches {
+		files = append(files, filepath.Base(m))
+	}
+	sort.Strings(files)
+	if expected := []string{"c", "d"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %q but got %q", expected, files)
+	}
+}
+
+func TestSquashKeepsUnknownFields(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	var layers []v1.Descriptor
+	var diffIDs []digest.Digest
+	for _, name := range []string{"a", "b", "c"} {
+		layer := putBlob(t, l, v1.MediaTypeImageLayer, readAll(t, archive(t, entry{name, tar.TypeReg, name})))
+		layers = append(layers, layer)
+		diffIDs = append(diffIDs, layer.Digest)
+	}
+	config := putJSON(t, l, v1.MediaTypeImageConfig, map[string]interface{}{
+		"architecture":     linuxAmd64.Architecture,
+		"os":               linuxAmd64.OS,
+		"config":           map[string]interface{}{"Healthcheck": map[string]interface{}{"Test": []string{"CMD", "true"}}},
+		"container_config": map[string]interface{}{"Hostname": "build"},
+		"rootfs":           map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+	})
+	manifest := putJSON(t, l, v1.MediaTypeImageManifest, map[string]interface{}{
+		"schemaVersion": 2,
+		"config":        map[string]interface{}{"mediaType": config.MediaType, "digest": config.Digest, "size": config.Size, "x-config": "kept"},
+		"layers": []interface{}{
+			map[string]interface{}{"mediaType": layers[0].MediaType, "digest": layers[0].Digest, "size": layers[0].Size, "x-layer": "kept"},
+			layers[1],
+			layers[2],
+		},
+		"x-manifest": "kept",
+	})
+
+	squashed, err := l.Squash(manifest, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m v1.Manifest
+	readJSON(t, l, squashed, &m)
+	if m.Config.Digest == config.Digest {
+		t.Error("expected a rewritten config")
+	}
+	var fields struct {
+		Field  string                   `json:"x-manifest"`
+		Config map[string]interface{}   `json:"config"`
+		Layers []map[string]interface{} `json:"layers"`
+	}
+	readJSON(t, l, squashed, &fields)
+	if fields.Field != "kept" || fields.Config["x-config"] != "kept" || len(fields.Layers) != 2 || fields.Layers[0]["x-layer"] != "kept" {
+		t.Errorf("unknown fields of the manifest were dropped: %+v", fields)
+	}
+
+	var c struct {
+		Config          map[string]interface{} `json:"config"`
+		ContainerConfig map[string]interface{} `json:"container_config"`
+		RootFS          v1.RootFS              `json:"rootfs"`
+	}
+	readJSON(t, l, m.Config, &c)
+	if c.Config["Healthcheck"] == nil || c.ContainerConfig["Hostname"] != "build" {
+		t.Errorf("unknown fields of the config were dropped: %+v", c)
+	}
+	if len(c.RootFS.DiffIDs) != 2 || c.RootFS.DiffIDs[0] != diffIDs[0] {
+		t.Errorf("unexpected diff_ids %v", c.RootFS.DiffIDs)
+	}
+}
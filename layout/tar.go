@@ -0,0 +1,269 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// maxMetadataSize limits the size of the oci-layout and index.json files
+// read by Unpack.
+const maxMetadataSize = 32 << 20
+
+// Pack writes the image layout to w as a tar archive. The oci-layout and
+// index.json files come first, so consumers can process the archive while
+// it streams, followed by all blobs. Hidden files, like the lock file, are
+// not included.
+//
+// Pack holds the lock of the image layout, so neither index.json nor the
+// blobs it references are changed by GC or index updates while they are
+// packed.
+func (l *Layout) Pack(w io.Writer) error {
+	unlock, err := l.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tw := tar.NewWriter(w)
+	for _, name := range []string{v1.ImageLayoutFile, IndexFile} {
+		if err := l.packFile(tw, name); err != nil {
+			return err
+		}
+	}
+
+	if err := l.packFile(tw, BlobsDir); err != nil {
+		return err
+	}
+	dirs, err := ioutil.ReadDir(filepath.Join(l.root, BlobsDir))
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s", l.root)
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		name := path.Join(BlobsDir, dir.Name())
+		if err := l.packFile(tw, name); err != nil {
+			return err
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(l.root, BlobsDir, dir.Name()))
+		if err != nil {
+			return errors.Wrapf(err, "image layout %s", l.root)
+		}
+		for _, fi := range files {
+			if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			if err := l.packFile(tw, path.Join(name, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to write archive", l.root)
+	}
+	return nil
+}
+
+// packFile writes the file or directory name, a slash separated path
+// relative to the image layout directory, to tw.
+func (l *Layout) packFile(tw *tar.Writer, name string) error {
+	p := filepath.Join(l.root, filepath.FromSlash(name))
+	fi, err := os.Stat(p)
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s", l.root)
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		ModTime: fi.ModTime(),
+	}
+	if fi.IsDir() {
+		hdr.Name += "/"
+		hdr.Typeflag = tar.TypeDir
+		hdr.Mode = 0755
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "image layout %s: unable to write archive", l.root)
+		}
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s", l.root)
+	}
+	defer f.Close()
+
+	hdr.Typeflag = tar.TypeReg
+	hdr.Mode = 0644
+	hdr.Size = fi.Size()
+	if err := tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to write archive", l.root)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to write %s to the archive", l.root, name)
+	}
+	return nil
+}
+
+// Unpack reads an image layout from the tar archive r, as written by Pack,
+// into the directory at path, which must not exist or be empty. Entries can
+// come in any order. Blobs are checked against the digest given by their
+// name while they are written. Entries with absolute names or names leaving
+// the image layout are rejected, as are links and other special files.
+// Regular files which are not part of an image layout are skipped.
+//
+// The oci-layout file is written last, so a failed Unpack does not leave
+// a directory which can be opened as an image layout.
+func Unpack(r io.Reader, path string) (*Layout, error) {
+	if entries, err := ioutil.ReadDir(path); err == nil && len(entries) > 0 {
+		return nil, errors.Errorf("unable to unpack image layout: %s is not empty", path)
+	}
+	if err := os.MkdirAll(filepath.Join(path, BlobsDir), 0755); err != nil {
+		return nil, errors.Wrap(err, "unable to unpack image layout")
+	}
+	l := &Layout{root: path}
+
+	var header, index []byte
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to unpack image layout")
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			// pax global headers hold no file
+			continue
+		}
+
+		name, err := archiveName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+		default:
+			return nil, errors.Errorf("unable to unpack image layout: %s: unsupported entry type %q", hdr.Name, hdr.Typeflag)
+		}
+
+		switch {
+		case name == v1.ImageLayoutFile:
+			if header, err = readMetadata(tr, header, name); err != nil {
+				return nil, err
+			}
+		case name == IndexFile:
+			if index, err = readMetadata(tr, index, name); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, BlobsDir+"/"):
+			parts := strings.Split(name, "/")
+			if len(parts) != 3 {
+				return nil, errors.Errorf("unable to unpack image layout: %s is not a blob", hdr.Name)
+			}
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(parts[1]), parts[2])
+			if _, err := l.PutBlobDigest(tr, dgst); err != nil {
+				return nil, errors.Wrap(err, "unable to unpack image layout")
+			}
+		}
+	}
+
+	if header == nil {
+		return nil, errors.Errorf("unable to unpack image layout: no %s file", v1.ImageLayoutFile)
+	}
+	if index == nil {
+		return nil, errors.Errorf("unable to unpack image layout: no %s file", IndexFile)
+	}
+	if err := schema.ValidatorMediaTypeImageIndex.Validate(bytes.NewReader(index)); err != nil {
+		return nil, errors.Wrapf(err, "unable to unpack image layout: invalid %s file", IndexFile)
+	}
+	if err := checkHeader(header); err != nil {
+		return nil, errors.Wrap(err, "unable to unpack image layout")
+	}
+
+	if err := writeFileAtomic(filepath.Join(path, IndexFile), index); err != nil {
+		return nil, errors.Wrap(err, "unable to unpack image layout")
+	}
+	if err := writeFileAtomic(filepath.Join(path, v1.ImageLayoutFile), header); err != nil {
+		return nil, errors.Wrap(err, "unable to unpack image layout")
+	}
+	return l, nil
+}
+
+// archiveName returns the cleaned, slash separated path of the tar entry
+// name, relative to the image layout directory, rejecting absolute names
+// and names leaving the directory.
+func archiveName(name string) (string, error) {
+	if strings.Contains(name, `\`) {
+		return "", errors.Errorf("unable to unpack image layout: invalid entry name %q", name)
+	}
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", errors.Errorf("unable to unpack image layout: entry %q is outside of the image layout", name)
+	}
+	return clean, nil
+}
+
+// readMetadata reads the content of the file name from r,
+// failing if it was already read into prev.
+func readMetadata(r io.Reader, prev []byte, name string) ([]byte, error) {
+	if prev != nil {
+		return nil, errors.Errorf("unable to unpack image layout: duplicate %s file", name)
+	}
+	p, err := ioutil.ReadAll(io.LimitReader(r, maxMetadataSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unpack image layout")
+	}
+	if len(p) > maxMetadataSize {
+		return nil, errors.Errorf("unable to unpack image layout: %s file is too large", name)
+	}
+	return p, nil
+}
+
+// checkHeader validates the content of an oci-layout file.
+func checkHeader(buf []byte) error {
+	if err := schema.ValidatorMediaTypeLayoutHeader.Validate(bytes.NewReader(buf)); err != nil {
+		return errors.Wrapf(err, "invalid %s file", v1.ImageLayoutFile)
+	}
+
+	var header v1.ImageLayout
+	if err := json.Unmarshal(buf, &header); err != nil {
+		return errors.Wrapf(err, "invalid %s file", v1.ImageLayoutFile)
+	}
+	if header.Version != v1.ImageLayoutVersion {
+		return errors.Errorf("unsupported image layout version %q", header.Version)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPackUnpack(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	if err := l.Tag("v1", putImage(t, l, "a", linuxAmd64)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := l.Pack(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 7 || names[0] != v1.ImageLayoutFile || names[1] != layout.IndexFile {
+		t.Errorf("expected oci-layout, index.json and the blobs but got %v", names)
+	}
+	for _, name := range names {
+		if name == layout.LockFile {
+			t.Error("the lock file was packed")
+		}
+	}
+
+	dir := filepath.Join(filepath.Dir(l.Path()), "unpacked")
+	u, err := layout.Unpack(buf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Fsck(schema.Options{}); err != nil {
+		t.Errorf("unpacked layout is not consistent: %v", err)
+	}
+
+	expected, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := u.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(index, expected) {
+		t.Errorf("expected index %+v but got %+v", expected, index)
+	}
+}
+
+type entry struct {
+	name     string
+	typeflag byte
+	content  string
+}
+
+func archive(t *testing.T, entries ...entry) io.Reader {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, Size: int64(len(e.content))}
+		switch e.typeflag {
+		case tar.TypeSymlink:
+			hdr.Linkname = e.content
+			hdr.Size = 0
+		case tar.TypeXGlobalHeader:
+			hdr = &tar.Header{Name: e.name, Typeflag: e.typeflag, PAXRecords: map[string]string{"comment": e.content}}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestUnpackErrors(t *testing.T) {
+	header := entry{name: v1.ImageLayoutFile, typeflag: tar.TypeReg, content: testHeader}
+	index := entry{name: layout.IndexFile, typeflag: tar.TypeReg, content: `{"schemaVersion":2,"manifests":[]}`}
+	blob := func(name, content string) entry {
+		return entry{name: name, typeflag: tar.TypeReg, content: content}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		entries []entry
+		message string
+	}{
+		{
+			name:    "valid in any order",
+			entries: []entry{blob("./blobs/sha256/"+testDigest.Encoded(), testBlob), index, header, blob("README", "skipped")},
+		},
+		{
+			// as written by git archive
+			name:    "pax global header",
+			entries: []entry{{name: "pax_global_header", typeflag: tar.TypeXGlobalHeader, content: "0123456789abcdef"}, header, index},
+		},
+		{
+			name:    "parent directory",
+			entries: []entry{header, index, blob("../evil", "x")},
+			message: "outside of the image layout",
+		},
+		{
+			name:    "parent directory below blobs",
+			entries: []entry{header, index, blob("blobs/../../evil", "x")},
+			message: "outside of the image layout",
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{header, index, blob("/etc/evil", "x")},
+			message: "outside of the image layout",
+		},
+		{
+			name:    "symlink",
+			entries: []entry{header, index, {name: "blobs/sha256/" + testDigest.Encoded(), typeflag: tar.TypeSymlink, content: "/etc/passwd"}},
+			message: "unsupported entry type",
+		},
+		{
+			name:    "digest mismatch",
+			entries: []entry{header, index, blob("blobs/sha256/"+testDigest.Encoded(), "tampered")},
+			message: "has digest",
+		},
+		{
+			name:    "invalid blob name",
+			entries: []entry{header, index, blob("blobs/sha256/abc", testBlob)},
+			message: "invalid digest",
+		},
+		{
+			name:    "missing oci-layout",
+			entries: []entry{index},
+			message: "no oci-layout file",
+		},
+		{
+			name:    "duplicate index.json",
+			entries: []entry{header, index, index},
+			message: "duplicate index.json",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "layout-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			target := filepath.Join(dir, "layout")
+			_, err = layout.Unpack(archive(t, tt.entries...), target)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if _, err := layout.Open(target); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("expected an error containing %q but got %v", tt.message, err)
+			}
+			if _, err := layout.Open(target); err == nil {
+				t.Error("a failed unpack left an image layout")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+				t.Error("a file was written outside of the image layout")
+			}
+		})
+	}
+}
+
+func TestUnpackNotEmpty(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"file": "content"})
+	defer os.RemoveAll(dir)
+
+	if _, err := layout.Unpack(archive(t), dir); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/canonical"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Matcher selects descriptors of index.json.
+type Matcher func(desc v1.Descriptor) bool
+
+// Create creates a new image layout in the directory at path, which is
+// created if needed, with an index.json file holding no descriptors.
+// The oci-layout file is written last, so an interrupted Create does
+// not leave a directory which can be opened as an image layout.
+func Create(path string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(path, v1.ImageLayoutFile)); err == nil {
+		return nil, errors.Errorf("image layout %s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Join(path, BlobsDir), 0755); err != nil {
+		return nil, errors.Wrap(err, "unable to create image layout")
+	}
+
+	l := &Layout{root: path}
+	if err := l.writeIndex(v1.Index{}, nil); err != nil {
+		return nil, err
+	}
+
+	header, err := canonical.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(path, v1.ImageLayoutFile), header); err != nil {
+		return nil, errors.Wrapf(err, "image layout %s", path)
+	}
+	return l, nil
+}
+
+// PutBlob stores the content of r as a blob, digested with digest.Canonical,
+// and returns its digest and size. The content is written to a temporary
+// file which is renamed into place once it is complete, so the blob is
+// either missing or complete, even if several writers store it at once.
+func (l *Layout) PutBlob(r io.Reader) (digest.Digest, int64, error) {
+	return l.putBlob(r, digest.Canonical, "")
+}
+
+// PutBlobDigest is like PutBlob, but stores the content of r as the blob
+// with the given digest. If the content does not match the digest, nothing
+// is stored and an error is returned.
+func (l *Layout) PutBlobDigest(r io.Reader, dgst digest.Digest) (int64, error) {
+	if err := dgst.Validate(); err != nil {
+		return 0, errors.Wrapf(err, "invalid digest %q", dgst)
+	}
+	_, size, err := l.putBlob(r, dgst.Algorithm(), dgst)
+	return size, err
+}
+
+// putBlob stores the content of r, digested with alg. If expected is not
+// empty, the content is only stored if it has that digest.
+func (l *Layout) putBlob(r io.Reader, alg digest.Algorithm, expected digest.Digest) (digest.Digest, int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(l.root, BlobsDir), ".ingest-")
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "image layout %s", l.root)
+	}
+	defer os.Remove(tmp.Name())
+
+	digester := alg.Digester()
+	size, err := io.Copy(io.MultiWriter(tmp, digester.Hash()), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "image layout %s: unable to write blob", l.root)
+	}
+
+	dgst := digester.Digest()
+	if expected != "" && dgst != expected {
+		return "", 0, errors.Errorf("image layout %s: content of blob %s has digest %s", l.root, expected, dgst)
+	}
+	path, err := l.BlobPath(dgst)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, errors.Wrapf(err, "image layout %s", l.root)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", 0, errors.Wrapf(err, "image layout %s", l.root)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, errors.Wrapf(err, "image layout %s: unable to store blob %s", l.root, dgst)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return "", 0, errors.Wrapf(err, "image layout %s", l.root)
+	}
+	return dgst, size, nil
+}
+
+// UpdateIndex reads index.json, calls fn to modify the index
+// and atomically replaces index.json with the result.
+// index.json is left unchanged if fn returns an error.
+//
+// The update holds the lock of the image layout and is only applied if
+// index.json has not been changed since it was read, which protects it
+// from writers that do not use the lock. If index.json was changed, fn is
+// called again with the new index, up to a few times. Fields unknown to
+// v1.Index are kept, see CompareAndSwapIndex.
+func (l *Layout) UpdateIndex(fn func(index *v1.Index) error) error {
+	unlock, err := l.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for attempt := 0; ; attempt++ {
+		index, dgst, err := l.IndexWithDigest()
+		if err != nil {
+			return err
+		}
+		if err := fn(&index); err != nil {
+			return err
+		}
+
+		err = l.compareAndSwapIndex(dgst, index)
+		if errors.Cause(err) != ErrIndexChanged || attempt == maxIndexUpdates-1 {
+			return err
+		}
+	}
+}
+
+// maxIndexUpdates is how often UpdateIndex tries to apply an update.
+const maxIndexUpdates = 5
+
+// ErrIndexChanged is the cause of the error returned by CompareAndSwapIndex
+// if index.json does not have the expected digest.
+var ErrIndexChanged = errors.New("index.json has been changed")
+
+// CompareAndSwapIndex atomically replaces index.json with index, if the
+// digest of index.json is still old, as returned by IndexWithDigest.
+// Otherwise it fails with ErrIndexChanged and leaves index.json unchanged.
+// The fields of index.json and of its descriptors which v1.Index and
+// v1.Descriptor do not know about are kept, for the descriptors which
+// are still present in index.
+// It holds the lock of the image layout while comparing and replacing.
+func (l *Layout) CompareAndSwapIndex(old digest.Digest, index v1.Index) error {
+	unlock, err := l.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return l.compareAndSwapIndex(old, index)
+}
+
+func (l *Layout) compareAndSwapIndex(old digest.Digest, index v1.Index) error {
+	buf, err := ioutil.ReadFile(filepath.Join(l.root, IndexFile))
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s", l.root)
+	}
+	if digest.FromBytes(buf) != old {
+		return errors.Wrapf(ErrIndexChanged, "image layout %s", l.root)
+	}
+	return l.writeIndex(index, buf)
+}
+
+// AddDescriptor appends desc to the descriptors of index.json,
+// unless an equal descriptor is already present.
+func (l *Layout) AddDescriptor(desc v1.Descriptor) error {
+	return l.UpdateIndex(func(index *v1.Index) error {
+		for _, d := range index.Manifests {
+			if reflect.DeepEqual(d, desc) {
+				return nil
+			}
+		}
+		index.Manifests = append(index.Manifests, desc)
+		return nil
+	})
+}
+
+// ReplaceDescriptor replaces the descriptors of index.json selected by
+// match with desc, which takes the position of the first of them.
+// If no descriptor is selected, desc is appended.
+func (l *Layout) ReplaceDescriptor(match Matcher, desc v1.Descriptor) error {
+	return l.UpdateIndex(func(index *v1.Index) error {
+		manifests := make([]v1.Descriptor, 0, len(index.Manifests)+1)
+		replaced := false
+		for _, d := range index.Manifests {
+			switch {
+			case !match(d):
+				manifests = append(manifests, d)
+			case !replaced:
+				manifests = append(manifests, desc)
+				replaced = true
+			}
+		}
+		if !replaced {
+			manifests = append(manifests, desc)
+		}
+		index.Manifests = manifests
+		return nil
+	})
+}
+
+// RemoveDescriptors removes the descriptors of index.json selected by match
+// and returns how many were removed.
+func (l *Layout) RemoveDescriptors(match Matcher) (int, error) {
+	var removed int
+	err := l.UpdateIndex(func(index *v1.Index) error {
+		manifests := make([]v1.Descriptor, 0, len(index.Manifests))
+		for _, d := range index.Manifests {
+			if match(d) {
+				removed++
+				continue
+			}
+			manifests = append(manifests, d)
+		}
+		index.Manifests = manifests
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// writeIndex atomically replaces index.json with the canonical JSON
+// serialization of index, keeping the unknown fields of old, the
+// previous content of index.json, if any; see CompareAndSwapIndex.
+func (l *Layout) writeIndex(index v1.Index, old []byte) error {
+	index.SchemaVersion = 2
+	if index.Manifests == nil {
+		index.Manifests = []v1.Descriptor{}
+	}
+
+	object, err := mergeIndex(index, old)
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to update %s", l.root, IndexFile)
+	}
+	p, err := canonical.Marshal(object)
+	if err != nil {
+		return errors.Wrapf(err, "image layout %s", l.root)
+	}
+	if err := writeFileAtomic(filepath.Join(l.root, IndexFile), p); err != nil {
+		return errors.Wrapf(err, "image layout %s: unable to write %s", l.root, IndexFile)
+	}
+	return nil
+}
+
+// mergeIndex returns index as a JSON object with the unknown fields of
+// the JSON index old. Each descriptor of index equal to one of old gets
+// the unknown fields of that one; other descriptors are new.
+func mergeIndex(index v1.Index, old []byte) (map[string]json.RawMessage, error) {
+	var extra map[string]json.RawMessage
+	var entries []json.RawMessage
+	if old != nil {
+		var err error
+		if extra, err = unknownFields(old, &v1.Index{}); err != nil {
+			return nil, err
+		}
+		var oldIndex struct {
+			Manifests []json.RawMessage `json:"manifests"`
+		}
+		if err := json.Unmarshal(old, &oldIndex); err != nil {
+			return nil, err
+		}
+		entries = oldIndex.Manifests
+	}
+
+	used := make([]bool, len(entries))
+	manifests := make([]map[string]json.RawMessage, len(index.Manifests))
+	for i, desc := range index.Manifests {
+		var fields map[string]json.RawMessage
+		for j, entry := range entries {
+			var d v1.Descriptor
+			if used[j] || json.Unmarshal(entry, &d) != nil || !reflect.DeepEqual(d, desc) {
+				continue
+			}
+			used[j] = true
+			var err error
+			if fields, err = unknownFields(entry, &v1.Descriptor{}); err != nil {
+				return nil, err
+			}
+			break
+		}
+		var err error
+		if manifests[i], err = withFields(desc, fields); err != nil {
+			return nil, err
+		}
+	}
+
+	object, err := withFields(index, extra)
+	if err != nil {
+		return nil, err
+	}
+	if object["manifests"], err = json.Marshal(manifests); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// unknownFields returns the fields of the JSON object p which are lost
+// by decoding it into v, a pointer, and encoding v again.
+func unknownFields(p []byte, v interface{}) (map[string]json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(p, &object); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(p, v); err != nil {
+		return nil, err
+	}
+	known, err := withFields(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key := range known {
+		delete(object, key)
+	}
+	return object, nil
+}
+
+// withFields returns v encoded as a JSON object,
+// with the given fields added where v has none.
+func withFields(v interface{}, fields map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(p, &object); err != nil {
+		return nil, err
+	}
+	for key, field := range fields {
+		if _, ok := object[key]; !ok {
+			object[key] = field
+		}
+	}
+	return object, nil
+}
+
+// writeFileAtomic replaces the file at path with p, writing p to
+// a temporary file next to it which is synced and renamed into place.
+func writeFileAtomic(path string, p []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(p)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes the entries of the directory at path,
+// making renames into it durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
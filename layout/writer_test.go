@@ -0,0 +1,256 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/layout"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// createLayout creates an empty image layout in a temporary directory.
+func createLayout(t *testing.T) *layout.Layout {
+	dir, err := ioutil.TempDir("", "layout-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := layout.Create(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func removeLayout(l *layout.Layout) {
+	os.RemoveAll(filepath.Dir(l.Path()))
+}
+
+func TestCreate(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	if _, err := layout.Open(l.Path()); err != nil {
+		t.Fatalf("unable to open created layout: %v", err)
+	}
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.SchemaVersion != 2 || len(index.Manifests) != 0 {
+		t.Errorf("unexpected index %+v", index)
+	}
+
+	if _, err := layout.Create(l.Path()); err == nil {
+		t.Error("expected an error when creating an existing layout")
+	}
+}
+
+func TestPutBlob(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dgst, size, err := l.PutBlob(strings.NewReader(testBlob))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if dgst != testDigest || size != int64(len(testBlob)) {
+				t.Errorf("expected %s with size %d but got %s with size %d", testDigest, len(testBlob), dgst, size)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rc, err := l.Get(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(p) != testBlob {
+		t.Errorf("expected %q but got %q, %v", testBlob, p, err)
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(l.Path(), layout.BlobsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "sha256" {
+		t.Errorf("expected only the sha256 directory in blobs but got %v", entries)
+	}
+}
+
+func TestPutBlobError(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	if _, _, err := l.PutBlob(&failingReader{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(l.Path(), layout.BlobsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no leftovers in blobs but got %v", entries)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestUpdateIndex(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	desc := func(s, name string) v1.Descriptor {
+		d := v1.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    digest.FromString(s),
+			Size:      int64(len(s)),
+		}
+		if name != "" {
+			d.Annotations = map[string]string{v1.AnnotationRefName: name}
+		}
+		return d
+	}
+	named := func(name string) layout.Matcher {
+		return func(d v1.Descriptor) bool {
+			return d.Annotations[v1.AnnotationRefName] == name
+		}
+	}
+	expect := func(expected ...v1.Descriptor) {
+		index, err := l.Index()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(index.Manifests) != len(expected) {
+			t.Fatalf("expected %d descriptors but got %+v", len(expected), index.Manifests)
+		}
+		for i, d := range index.Manifests {
+			if d.Digest != expected[i].Digest || d.Annotations[v1.AnnotationRefName] != expected[i].Annotations[v1.AnnotationRefName] {
+				t.Errorf("descriptor %d: expected %+v but got %+v", i, expected[i], d)
+			}
+		}
+	}
+
+	a, b, c := desc("a", "v1"), desc("b", "v2"), desc("c", "v1")
+	for _, d := range []v1.Descriptor{a, b, a} {
+		if err := l.AddDescriptor(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(a, b)
+
+	if err := l.ReplaceDescriptor(named("v1"), c); err != nil {
+		t.Fatal(err)
+	}
+	expect(c, b)
+
+	if err := l.ReplaceDescriptor(named("v3"), a); err != nil {
+		t.Fatal(err)
+	}
+	expect(c, b, a)
+
+	n, err := l.RemoveDescriptors(named("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 removed descriptors but got %d", n)
+	}
+	expect(b)
+
+	failed := errors.New("failed")
+	if err := l.UpdateIndex(func(index *v1.Index) error {
+		index.Manifests = nil
+		return failed
+	}); err != failed {
+		t.Errorf("expected %v but got %v", failed, err)
+	}
+	expect(b)
+
+	p, err := ioutil.ReadFile(filepath.Join(l.Path(), layout.IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(p), `{"manifests":[{"annotations":{"org.opencontainers.image.ref.name":"v2"}`) {
+		t.Errorf("expected canonical JSON but got %s", p)
+	}
+}
+
+func TestUpdateIndexKeepsUnknownFields(t *testing.T) {
+	l := createLayout(t)
+	defer removeLayout(l)
+
+	kept, replaced := digest.FromString("kept"), digest.FromString("replaced")
+	index := fmt.Sprintf(`{"schemaVersion":2,"x-top":"kept","manifests":[
+		{"mediaType":%q,"digest":%q,"size":4,"annotations":{%q:"kept"},"x-extra":"kept"},
+		{"mediaType":%q,"digest":%q,"size":8,"annotations":{%q:"v1"},"x-extra":"replaced"}]}`,
+		v1.MediaTypeImageManifest, kept, v1.AnnotationRefName,
+		v1.MediaTypeImageManifest, replaced, v1.AnnotationRefName)
+	if err := ioutil.WriteFile(filepath.Join(l.Path(), layout.IndexFile), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	desc := v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("new"), Size: 3}
+	if err := l.Tag("v1", desc); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Tag("v2", desc); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ioutil.ReadFile(filepath.Join(l.Path(), layout.IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Top       string                   `json:"x-top"`
+		Manifests []map[string]interface{} `json:"manifests"`
+	}
+	if err := json.Unmarshal(p, &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.Top != "kept" {
+		t.Errorf("the unknown field of the index was dropped: %s", p)
+	}
+	if len(written.Manifests) != 3 {
+		t.Fatalf("expected 3 descriptors but got %s", p)
+	}
+	for i, expected := range []interface{}{"kept", nil, nil} {
+		if extra := written.Manifests[i]["x-extra"]; extra != expected {
+			t.Errorf("descriptor %d: expected the unknown field %v but got %v", i, expected, extra)
+		}
+	}
+}
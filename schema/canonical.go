@@ -0,0 +1,31 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"github.com/opencontainers/image-spec/canonical"
+	"github.com/pkg/errors"
+)
+
+// checkCanonical warns if buf is not serialized as canonical JSON.
+// Documents which are not valid JSON are left to the schema validation.
+func checkCanonical(buf []byte, rep *report) {
+	switch err := errors.Cause(canonical.Check(buf)).(type) {
+	case canonical.NotCanonicalError:
+		rep.warnAtf(RuleCanonicalJSON, err.Offset, "document is not canonical JSON, first difference at byte %d", err.Offset)
+	case canonical.UnsupportedValueError:
+		rep.warnAtf(RuleCanonicalJSON, 0, "document cannot be serialized as canonical JSON: %v", err)
+	}
+}
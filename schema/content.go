@@ -0,0 +1,212 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// BlobProvider gives access to content-addressed blobs,
+// for example the blobs of an image layout directory.
+type BlobProvider interface {
+	// Get returns a reader for the content of the blob with the given digest.
+	Get(dgst digest.Digest) (io.ReadCloser, error)
+}
+
+// ValidateContent fetches the blob referenced by desc from blobs,
+// checks that it has the size and digest declared by the descriptor
+// and validates it with the Validator for its media type.
+// The descriptors of manifests and image indexes are followed recursively,
+// so a single call checks a whole image graph. Image manifests are
+// checked for consistency with their config using ValidateRootFS.
+// Blobs with unknown media types are only checked for size and digest.
+//
+// All problems are collected into a single ValidationError,
+// with each Finding recording the blob it was found in.
+func ValidateContent(desc v1.Descriptor, blobs BlobProvider, opts Options) ([]Finding, error) {
+	return ValidateContents([]v1.Descriptor{desc}, blobs, opts)
+}
+
+// ValidateContents is like ValidateContent for several descriptors,
+// for example those of an image index. Blobs referenced more than once
+// are validated once.
+func ValidateContents(descs []v1.Descriptor, blobs BlobProvider, opts Options) ([]Finding, error) {
+	w := &contentWalker{
+		blobs:   blobs,
+		opts:    opts,
+		visited: map[digest.Digest]bool{},
+	}
+	for _, desc := range descs {
+		w.walk(desc)
+	}
+
+	if len(w.errs) == 0 {
+		return w.warnings, nil
+	}
+	return w.warnings, ValidationError{
+		Errs:     w.errs,
+		Findings: w.findings,
+	}
+}
+
+// contentWalker collects the results of ValidateContent.
+type contentWalker struct {
+	blobs    BlobProvider
+	opts     Options
+	visited  map[digest.Digest]bool
+	warnings []Finding
+	errs     []error
+	findings []Finding
+}
+
+// fail records err for the blob referenced by desc.
+func (w *contentWalker) fail(desc v1.Descriptor, err error) {
+	if verr, ok := errors.Cause(err).(ValidationError); ok {
+		for _, e := range verr.Errs {
+			w.errs = append(w.errs, errors.Wrapf(e, "blob %s", desc.Digest))
+		}
+		for _, f := range verr.Findings {
+			f.Blob = desc.Digest
+			w.findings = append(w.findings, f)
+		}
+		return
+	}
+	w.errs = append(w.errs, errors.Wrapf(err, "blob %s", desc.Digest))
+}
+
+func (w *contentWalker) walk(desc v1.Descriptor) {
+	if w.visited[desc.Digest] {
+		return
+	}
+	w.visited[desc.Digest] = true
+
+	if err := desc.Digest.Validate(); err != nil {
+		w.fail(desc, errors.Wrap(err, "invalid digest"))
+		return
+	}
+
+	rc, err := w.blobs.Get(desc.Digest)
+	if os.IsNotExist(err) {
+		w.fail(desc, errors.New("blob not found"))
+		return
+	}
+	if err != nil {
+		w.fail(desc, errors.Wrap(err, "unable to get blob"))
+		return
+	}
+	defer rc.Close()
+
+	// The reader fails as soon as the blob exceeds its declared size,
+	// so oversized blobs are detected without reading them completely.
+	r, err := identity.NewVerifiedReader(rc, desc)
+	if err != nil {
+		w.fail(desc, err)
+		return
+	}
+
+	opts := w.opts
+	opts.Warn = func(f Finding) {
+		f.Blob = desc.Digest
+		w.warnings = append(w.warnings, f)
+		if w.opts.Warn != nil {
+			w.opts.Warn(f)
+		}
+	}
+
+	v := Validator(desc.MediaType)
+	var buf []byte
+	switch {
+	case v.isLayer():
+		_, err = v.ValidateWithOptions(r, opts)
+	case v.isDocument():
+		if buf, err = ioutil.ReadAll(r); err == nil {
+			_, err = v.ValidateWithOptions(bytes.NewReader(buf), opts)
+		}
+	}
+
+	// The verified reader keeps failing after a failed read, and the
+	// content read before must not be trusted, so the failure replaces
+	// the result of the validation.
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		switch err := err.(type) {
+		case identity.SizeExceededError:
+			w.fail(desc, errors.Errorf("size exceeds the declared size %d", err.Size))
+		case identity.SizeMismatchError:
+			w.fail(desc, errors.Errorf("size %d does not match the declared size %d", err.Actual, err.Size))
+		case identity.DigestMismatchError:
+			w.fail(desc, errors.New("content does not match the digest"))
+		default:
+			w.fail(desc, errors.Wrap(err, "unable to read blob"))
+		}
+		return
+	}
+	if err != nil {
+		w.fail(desc, err)
+	}
+
+	switch desc.MediaType {
+	case v1.MediaTypeImageManifest:
+		var manifest v1.Manifest
+		if err := json.Unmarshal(buf, &manifest); err != nil {
+			return
+		}
+		errs := len(w.errs)
+		w.walk(manifest.Config)
+		for _, layer := range manifest.Layers {
+			w.walk(layer)
+		}
+		if len(w.errs) == errs && manifest.Config.MediaType == v1.MediaTypeImageConfig {
+			w.checkRootFS(manifest)
+		}
+	case v1.MediaTypeImageIndex:
+		var index v1.Index
+		if err := json.Unmarshal(buf, &index); err != nil {
+			return
+		}
+		for _, manifest := range index.Manifests {
+			w.walk(manifest)
+		}
+	}
+}
+
+// checkRootFS checks the consistency of manifest with its config.
+// It expects the blobs of the manifest to be valid.
+func (w *contentWalker) checkRootFS(manifest v1.Manifest) {
+	rc, err := w.blobs.Get(manifest.Config.Digest)
+	if err != nil {
+		w.fail(manifest.Config, errors.Wrap(err, "unable to get blob"))
+		return
+	}
+	defer rc.Close()
+
+	var config v1.Image
+	if err := json.NewDecoder(rc).Decode(&config); err != nil {
+		w.fail(manifest.Config, errors.Wrap(err, "config format mismatch"))
+		return
+	}
+
+	if err := ValidateRootFS(manifest, config, w.blobs); err != nil {
+		w.fail(manifest.Config, err)
+	}
+}
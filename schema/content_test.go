@@ -0,0 +1,248 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// memoryBlobs is an in-memory schema.BlobProvider.
+type memoryBlobs map[digest.Digest][]byte
+
+func (m memoryBlobs) Get(dgst digest.Digest) (io.ReadCloser, error) {
+	p, ok := m[dgst]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(p)), nil
+}
+
+// add stores p and returns a descriptor for it.
+func (m memoryBlobs) add(mediaType string, p []byte) v1.Descriptor {
+	dgst := digest.FromBytes(p)
+	m[dgst] = p
+	return v1.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(p)),
+	}
+}
+
+// addJSON stores the JSON encoding of v and returns a descriptor for it.
+func (m memoryBlobs) addJSON(t *testing.T, mediaType string, v interface{}) v1.Descriptor {
+	p, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.add(mediaType, p)
+}
+
+// tarLayer returns a tar archive holding the given headers.
+func tarLayer(t *testing.T, hdrs ...tar.Header) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range hdrs {
+		hdr := hdr
+		hdr.Mode = 0644
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testImage stores an image index, a manifest, a config and layer in blobs
+// and returns the descriptor of the index. The config and layer can be
+// modified through the arguments.
+func testImage(t *testing.T, blobs memoryBlobs, config v1.Image, layer []byte) v1.Descriptor {
+	layerDesc := blobs.add(v1.MediaTypeImageLayer, layer)
+	config.RootFS.DiffIDs = []digest.Digest{layerDesc.Digest}
+	configDesc := blobs.addJSON(t, v1.MediaTypeImageConfig, config)
+
+	manifestDesc := blobs.addJSON(t, v1.MediaTypeImageManifest, v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []v1.Descriptor{layerDesc},
+	})
+	manifestDesc.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+
+	return blobs.addJSON(t, v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{manifestDesc},
+	})
+}
+
+func validConfig() v1.Image {
+	return v1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       v1.RootFS{Type: "layers"},
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	validLayer := func(t *testing.T) []byte {
+		return tarLayer(t, tar.Header{Name: "etc/", Typeflag: tar.TypeDir}, tar.Header{Name: "etc/hosts", Typeflag: tar.TypeReg})
+	}
+
+	for _, tt := range []struct {
+		name   string
+		setup  func(t *testing.T, blobs memoryBlobs) v1.Descriptor
+		errors int
+	}{
+		{
+			name: "valid image",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				return testImage(t, blobs, validConfig(), validLayer(t))
+			},
+		},
+		{
+			name: "unknown media type is only verified",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				return blobs.add("application/vnd.example.blob", []byte("opaque"))
+			},
+		},
+		{
+			name: "missing blob",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				desc := testImage(t, blobs, validConfig(), validLayer(t))
+				for dgst, p := range blobs {
+					if bytes.HasPrefix(p, []byte("etc/")) {
+						delete(blobs, dgst)
+					}
+				}
+				return desc
+			},
+			errors: 1,
+		},
+		{
+			name: "size mismatch",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				desc := blobs.add(v1.MediaTypeImageLayer, validLayer(t))
+				desc.Size--
+				return desc
+			},
+			errors: 1,
+		},
+		{
+			name: "digest mismatch",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				desc := blobs.add("application/vnd.example.blob", []byte("opaque"))
+				blobs[desc.Digest] = []byte("OPAQUE")
+				return desc
+			},
+			errors: 1,
+		},
+		{
+			name: "invalid config",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				config := validConfig()
+				config.Config.Env = []string{"foo"}
+				return testImage(t, blobs, config, validLayer(t))
+			},
+			errors: 1,
+		},
+		{
+			name: "inconsistent rootfs",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				config := validConfig()
+				config.History = []v1.History{{CreatedBy: "a"}, {CreatedBy: "b"}}
+				return testImage(t, blobs, config, validLayer(t))
+			},
+			errors: 1,
+		},
+		{
+			name: "invalid layer",
+			setup: func(t *testing.T, blobs memoryBlobs) v1.Descriptor {
+				layer := tarLayer(t, tar.Header{Name: "a", Typeflag: tar.TypeReg}, tar.Header{Name: "./a", Typeflag: tar.TypeReg})
+				return testImage(t, blobs, validConfig(), layer)
+			},
+			errors: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := memoryBlobs{}
+			desc := tt.setup(t, blobs)
+
+			_, err := schema.ValidateContent(desc, blobs, schema.Options{})
+			if tt.errors == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			verr, ok := errors.Cause(err).(schema.ValidationError)
+			if !ok {
+				t.Fatalf("expected a validation error but got %v", err)
+			}
+			if len(verr.Errs) != tt.errors {
+				t.Errorf("expected %d errors but got %v", tt.errors, verr.Errs)
+			}
+		})
+	}
+}
+
+func TestValidateContents(t *testing.T) {
+	blobs := memoryBlobs{}
+	config := validConfig()
+	config.Config.Env = []string{"foo"}
+	index := testImage(t, blobs, config, tarLayer(t, tar.Header{Name: "a", Typeflag: tar.TypeReg}))
+	missing := blobs.add("application/vnd.example.blob", []byte("missing"))
+	delete(blobs, missing.Digest)
+
+	// the invalid config is shared by both descriptors but reported once
+	_, err := schema.ValidateContents([]v1.Descriptor{index, index, missing}, blobs, schema.Options{})
+	verr, ok := errors.Cause(err).(schema.ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+	if len(verr.Errs) != 2 {
+		t.Errorf("expected 2 errors but got %v", verr.Errs)
+	}
+}
+
+func TestValidateContentLargestSize(t *testing.T) {
+	blobs := memoryBlobs{}
+	desc := blobs.add("application/vnd.example.blob", []byte("opaque"))
+	desc.Size = math.MaxInt64
+
+	_, err := schema.ValidateContent(desc, blobs, schema.Options{})
+	verr, ok := errors.Cause(err).(schema.ValidationError)
+	if !ok || len(verr.Errs) != 1 {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+	if expected := fmt.Sprintf("size 6 does not match the declared size %d", desc.Size); !strings.Contains(verr.Errs[0].Error(), expected) {
+		t.Errorf("expected %q but got %v", expected, verr.Errs[0])
+	}
+}
@@ -15,9 +15,11 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 
+	"github.com/pkg/errors"
 	"go4.org/errorutil"
 )
 
@@ -42,3 +44,13 @@ func WrapSyntaxError(r io.Reader, err error) error {
 
 	return err
 }
+
+// formatMismatch wraps err, the error of decoding buf as a document
+// of the given kind, adding the position of JSON syntax errors.
+func formatMismatch(buf []byte, err error, kind string) error {
+	err = WrapSyntaxError(bytes.NewReader(buf), err)
+	if serr, ok := err.(*SyntaxError); ok {
+		return errors.Wrapf(err, "%s format mismatch at line %d, col %d", kind, serr.Line, serr.Col)
+	}
+	return errors.Wrapf(err, "%s format mismatch", kind)
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/xeipuuv/gojsonschema"
+	"go4.org/errorutil"
+)
+
+// Severity classifies a Finding.
+type Severity int
+
+const (
+	// SeverityError marks a violation which makes the document invalid.
+	SeverityError Severity = iota
+
+	// SeverityWarning marks a violation which does not make the document invalid.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// A Finding is a single problem found while validating a document.
+type Finding struct {
+	// Pointer is the JSON Pointer (RFC 6901) to the offending value.
+	// The empty string refers to the whole document.
+	Pointer string
+
+	// Keyword is the JSON schema keyword which failed, e.g. "required" or "pattern".
+	Keyword string
+
+	// Expected describes the value the schema asked for, if known.
+	Expected string
+
+	// Actual is the value found in the document, if known.
+	Actual interface{}
+
+	// Message is a human readable description of the problem.
+	Message string
+
+	// Rule identifies the violated SHOULD-level requirement.
+	// It is empty for violations of the JSON schema.
+	Rule Rule
+
+	// Severity classifies the finding.
+	Severity Severity
+
+	// Blob is the digest of the blob holding the document.
+	// It is only set by ValidateContent.
+	Blob digest.Digest
+
+	// Line, Col and Offset locate the offending value in the document.
+	// They are zero if the value could not be located.
+	Line, Col int
+	Offset    int64
+}
+
+func (f Finding) Error() string {
+	pointer := f.Pointer
+	if pointer == "" {
+		pointer = gojsonschema.STRING_CONTEXT_ROOT
+	}
+	msg := f.Message
+	if f.Rule != "" {
+		msg = fmt.Sprintf("%s [%s]", msg, f.Rule)
+	}
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s", pointer, msg)
+	}
+	return fmt.Sprintf("%s (line %d, col %d): %s", pointer, f.Line, f.Col, msg)
+}
+
+// keywords maps gojsonschema result error types to JSON schema keywords.
+var keywords = map[string]string{
+	"required":                        "required",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"const":                           "const",
+	"enum":                            "enum",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"contains":                        "contains",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"pattern":                         "pattern",
+	"format":                          "format",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+// expectedDetails lists the gojsonschema error details describing
+// the expected value, in order of preference.
+var expectedDetails = []string{"expected", "allowed", "pattern", "format", "min", "max", "multiple", "property"}
+
+// newFinding converts a gojsonschema result error for the document buf
+// into a Finding.
+func newFinding(buf []byte, rerr gojsonschema.ResultError) Finding {
+	tokens := contextTokens(rerr.Context())
+	keyword, ok := keywords[rerr.Type()]
+	if !ok {
+		keyword = rerr.Type()
+	}
+
+	f := Finding{
+		Pointer:  pointerString(tokens),
+		Keyword:  keyword,
+		Actual:   rerr.Value(),
+		Message:  rerr.Description(),
+		Severity: SeverityError,
+	}
+
+	details := rerr.Details()
+	for _, key := range expectedDetails {
+		if v, ok := details[key]; ok {
+			f.Expected = fmt.Sprint(v)
+			break
+		}
+	}
+	if given, ok := details["given"]; ok {
+		f.Actual = given
+	}
+
+	f.locate(buf, tokens)
+	return f
+}
+
+// locate sets the position of the value addressed by tokens in buf, if any.
+func (f *Finding) locate(buf []byte, tokens []string) {
+	offset, ok := pointerOffset(buf, tokens)
+	if !ok {
+		return
+	}
+	f.Offset = offset
+	f.Line, f.Col, _ = errorutil.HighlightBytePosition(bytes.NewReader(buf), offset)
+}
+
+// contextSeparator joins the context tokens so they can be split again.
+// JSON object keys may contain dots, which gojsonschema uses by default.
+const contextSeparator = "\x00"
+
+// contextTokens returns the reference tokens of a gojsonschema context,
+// dropping the leading "(root)" token.
+func contextTokens(c *gojsonschema.JsonContext) []string {
+	if c == nil {
+		return nil
+	}
+	tokens := strings.Split(c.String(contextSeparator), contextSeparator)
+	if len(tokens) > 0 && tokens[0] == gojsonschema.STRING_CONTEXT_ROOT {
+		tokens = tokens[1:]
+	}
+	return tokens
+}
+
+// pointerString encodes reference tokens as a JSON Pointer.
+func pointerString(tokens []string) string {
+	var buf bytes.Buffer
+	for _, token := range tokens {
+		token = strings.Replace(token, "~", "~0", -1)
+		token = strings.Replace(token, "/", "~1", -1)
+		buf.WriteString("/")
+		buf.WriteString(token)
+	}
+	return buf.String()
+}
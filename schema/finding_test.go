@@ -0,0 +1,88 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+func TestFindings(t *testing.T) {
+	for i, tt := range []struct {
+		layout   string
+		pointer  string
+		keyword  string
+		expected string
+		line     int
+	}{
+		{
+			layout: `{
+    "imageLayoutVersion": 2
+}`,
+			pointer:  "/imageLayoutVersion",
+			keyword:  "type",
+			expected: "string",
+			line:     2,
+		},
+		{
+			layout:   `{"imageLayoutVersion": "2.0.0"}`,
+			pointer:  "/imageLayoutVersion",
+			keyword:  "enum",
+			expected: `"1.0.0"`,
+			line:     1,
+		},
+		{
+			layout: `
+
+{"foo": "bar"}`,
+			pointer:  "",
+			keyword:  "required",
+			expected: "imageLayoutVersion",
+			line:     3,
+		},
+	} {
+		err := schema.ValidatorMediaTypeLayoutHeader.Validate(strings.NewReader(tt.layout))
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok {
+			t.Errorf("test %d: expected a validation error but got %v", i, err)
+			continue
+		}
+
+		if len(verr.Findings) != 1 {
+			t.Errorf("test %d: expected one finding but got %v", i, verr.Findings)
+			continue
+		}
+
+		f := verr.Findings[0]
+		if f.Pointer != tt.pointer {
+			t.Errorf("test %d: expected pointer %q but got %q", i, tt.pointer, f.Pointer)
+		}
+		if f.Keyword != tt.keyword {
+			t.Errorf("test %d: expected keyword %q but got %q", i, tt.keyword, f.Keyword)
+		}
+		if f.Expected != tt.expected {
+			t.Errorf("test %d: expected %q as expected value but got %q", i, tt.expected, f.Expected)
+		}
+		if f.Line != tt.line {
+			t.Errorf("test %d: expected line %d but got %d", i, tt.line, f.Line)
+		}
+		if f.Severity != schema.SeverityError {
+			t.Errorf("test %d: expected severity %v but got %v", i, schema.SeverityError, f.Severity)
+		}
+	}
+}
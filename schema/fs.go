@@ -314,8 +314,248 @@ Dj+ZAwAA
 `,
 	},
 
+	"/v1.1.0/config-schema.json": {
+		local:   "v1.1.0/config-schema.json",
+		size:    3033,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/+RWzU7bQBC++ylGC0fAPfSUW0W5VaJS1PZQIbSxx8lQ7852doJqId69ckwgG/8QBdFL
+r5P5fvabWWcfMgBTYiyEghJ7MwNzHdBfsldLHgUu2Ve0hHnAgioq7KbrLAMwp7FYobMtZKUaZnl+F9mf
+d9ULlmVeiq30/MPHvKuddDgqt5A4y3MO6IutWtzAuu6cnF1iXmz0O6Q2AVssL+6w0K4WhAOKEkYzg4cM
+AMAUglaxfC7sQKMK+Y4OAMBULM5q+0tpFc+VHJoMAOCxazF2rSuWCaq0W4oVKRa6FjwUc2+FrNdD2zke
+3nlxjxK7sR6KqNC25gdFrIhtXrIjRbfbN0IO8JiIPE10gH9nrgDDswUAMN8iSlIZVX5WBQAwV38CRyy/
+smjcx58KVps1wCpetIt8kpdYkad24WPubJhvmK87j8P8/n7MVhrdSHyTB9nG2BdVaQJTskEAAIY9Xrdn
++rlThD25SYsTNl+xmtrdszzpwq/r2mRjPDeDEVy68r89+3eu1w7jkec/duvf+1Q/WH6RX36mo+75F7vA
++r0jmQ8M/j0jmSuHOS29rY+J5JMs41UsbMByDL5grtH6Hfzg51uYtYpv+XyXVFW3VMZ//6186p9KL5FF
+v3a9jTG1bVCiGZ5YtqdqBH+vSbBMeF4y2HeX7TJuM19RVJbmbf/Je+MZH9DgC+r1tKZeU9C/Hv2X1etD
+PRvweLto3sDBzqHX4wnQBW1uNxsxTtK7Wcl+prcse1Lo7036uHx5Dab3MgO4yR6zvwMABwYiGtkLAAA=
+`,
+	},
+
+	"/v1.1.0/content-descriptor.json": {
+		local:   "v1.1.0/content-descriptor.json",
+		size:    1374,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/6yUQW/UMBCF7/kVo7RSQerWHFY9RFWlCi5c4AA3xMGxJ/GUjW3Gs6oW1P+OHCfsBlDb
+XbGnzWjem89jPf+sAGqLyTBFoeDrBuqPEf3b4EWTR4b8D73Au6kpMHyKaKgjo0fFZbY4T8bhoLPcicRG
+qfsU/KpUrwL3yrLuZPVmrUrtrOjIzpLUKBUiejNPTqOsdCv7e3rRyS5iVob2Ho2UWuQQkYUw1Q3kgwHU
+A1rSn0tzKf19XnEIY182hdBBLjB2yOgNWjiYkX/1OWOXdRa7tNqDXeUTnymLHXnK3kntp4/ax2JRJ/rx
+HE9uAfLQ7gTTkUz/ACEv1+slhKUekzyDYXgXJfSsoyMDxqH5lrYDFO2MVVguM27+jFoE2cPFjd70gUnc
+cNvc5Iu1aG8vTtnjxLrg3/ImPUGvYUMFMTdCx2GAB0fGgThKEzMMegctgg0PfhO0RXsK3Uiy3K0W/RSb
+BxxatJZ8Py9RNPcoaMFMeXvV6oTXa5gW9/rFd110SyDNQp028oIkvL/7cFfiAPs8UILZ4j/mQHsfZHxE
+Fjd5/JugDp1O4DuUF8JqoqwZv2+JMSN9+fNJOYzzMlUVwNfqsfo1AM7KYZFeBQAA
+`,
+	},
+
+	"/v1.1.0/defs-descriptor.json": {
+		local:   "v1.1.0/defs-descriptor.json",
+		size:    844,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/5SST2/TTBDG7/kU826jt0DiOHBAqlWKKnrnUE6t0mi6O7aneP9od6IqVPnuaG03SYtA
+cLC1+2jmefwbz9MEQBlKOnIQ9k5VoK6oZsf5liBgFNabDiOIh6+B3BfvBNlRhKuxzUe4DqS5Zo29x3ww
+3buoCnIOgLJkGL9tA+0lAMUmp7YiIVVl6QM5/ZyRFj42ZdItWSzZYkOl2aeWB7f5s5cM3ipJZNcc9IAi
+FHu8u9vL4gaLH8vibHU4/ncy/b+4Wy9mq6fl/P2Hj7vy78qmqo/YDUnKcENJjuleDVdaAh23QXwTMbSs
+Qbekv6eNhaEXfA25yN8/kJY5sOuvIwCcnmPX+MjS2ovqPI/KkLk4/ccJjFyzN5+r29liXaz2ytt3VT5f
+FjfL4uzTuljNXhFuYpf+wIfQ8QCRC6GO3sJjy7oFaTmNVGBxC/cExj+6zqMh8+v3Y4y4PcgsZI9zf08K
+oGofLea/oDaR1ajvXmCgc17w5XoCqGmkOvcZqtPiIXl3Uh4tcmkxXPdpw3uczCQ/u8nPAQD5nDLGTAMA
+AA==
+`,
+	},
+
+	"/v1.1.0/defs.json": {
+		local:   "v1.1.0/defs.json",
+		size:    1777,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/7STQY/bIBCF7/kVI9qj27UBg+1r23NW2mPVA+tMEqoNWBhLXa3y3ysShzg1rZTKGymW
+mRm+93jIbysAssG+dbrz2hrSAPmKW210WPUw9LgBv3d22O3t4MHvEdYdmi/WeKUNOnjqsNVb3arT9uzM
+iwDSQJAAINr4Kq4AiH/tMKhp43GHjmSXxkEbfRgOpIFPBa2uZfVrLBdUnorHLJILcS+aUSlS8FCf4Rm9
+F08LLnnFBE9pxOZMSPB7hWpKGZM0Z6IquZQiz/OEYmLqRnr4j9tJ6dCynHELsQBYlCWboxldAM1pzWsh
+aT3nC74Av6g4F5LzXDKZ12VJU+EX4tEGrpsKWoPrLWng+1iA2Ao/8tFh6JIPD5MP7mGMPA4es/Tuy2nM
+8PIymR7ffiSyWNKh4Ms6fFY9pm+r906b3eSycKPVZDBs1ka512+mtZsw2kTcaip5kToD7w/jD0OLHv+g
+uqcT9vxM5WCff2Lrrzl0ynt05tHZDp3X2N9m8vmtyI43pX8dIRlUNLU+S7+zqZH1N1Or8D+ufg8ACJCd
+FfEGAAA=
+`,
+	},
+
+	"/v1.1.0/image-index-schema.json": {
+		local:   "v1.1.0/image-index-schema.json",
+		size:    3367,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/7yWv27jOBDGez3FgAmQxokOh+AKI0hz16S6YoNtFikYcmRN1iK15DiJd+F3X1C0ZMqS
+Hcc2Nk3g4cw3v4//xF8ZgNDolaOayRoxBfF/jeZfa1iSQQcPlZwhPBiN7/ClRkUFKdmkTkLtpVclVjLU
+lcz1NM9fvDXXMXpj3SzXThZ8/ddtHmMXsY50W+KneW5rNKpt6ZuymJ1TaJ9TaB8LeVljKLXPL6g4xmpn
+a3RM6MUUgiUAEeu/ovPRVgwP3T6W5KEgnGvw0R564BKh6QxNZ4hi8BrVQHqQBsgwztCJSat8hKe8j9lJ
+tS4HPSoyVC0qMYW/NzH53saa0CqOiAo1yceotMt+cNrkhY5gi8a6wwIdGoUakmkOf+LSYRHqNBb+utWy
+7ias+kWusSBDQdvnm+49KOmYCqn4AK429c8C+kVUTNhazbCcaHhbtl9fSUMFevapQrue0jm5THYMY5Xm
+fXoTtc3+64g68fGzsh5x+GNBDkOvb120t2UmadjTz62Iphl6Fl3oKREfOY4D+f7Ayfvy1MUHSJYwNX0I
+Z0gEMvC8ZPRHsY4AkuF/bnfDref/EDzlljXbmZN1SQpUieq7X1QQFVrcyDgBMs3PWjKjM3B1J+cz64jL
+6n56F/aiRn1/dfy8b++bbV8LN/cfupIwp4ge0qFwtoK3klQJHG7z6AUquYRnBG3fzNxKjfp46oZqJ3M9
+l1xYVw25P3eYO50tzp3HeN9RXl+2qiRGxQuHW3UAwvY89c7w/nM81B6OH+0+3wudTIdnR2YmthJWYzbP
+iWf9eaBuXgdvk3PAdbLngSxQhnU49xRudPdg9j+WadvBZ/NgkwCrD22/SkfS8LjlD+Yw2/Wr10ZIYyw3
+z2h/6q2xubjyVPXouy4Vyca8rLL0f/euG3V01Jt4zMYpBlbZGnN4V4qx93fyhMsAnrJV9nsAHZlsRicN
+AAA=
+`,
+	},
+
+	"/v1.1.0/image-layout-schema.json": {
+		local:   "v1.1.0/image-layout-schema.json",
+		size:    439,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/2yPQUvEMBCF7/0VQ/SgsG0qeMp1TwvCHgQv4qG203aWbRKTqbBI/7sk0yrinsK8mS/v
+va8CQHUY20CeyVllQB092r2z3JDFAIepGRCemoubGZ7bEadG7RJ1G2UwoEZmb7Q+RWdLUSsXBt2Fpuey
+ftSi3QhH3YZEo7XzaNvNLGZMrjUlY33OxkLyxWNi3fsJ21XzwXkMTBiVgdQmOSRSEr9giFJLdv/bfsoF
+uB54RDjuD38r35HNC9dSKWGgpzPeq9324RYrciA7/Opo50kZeF1nAPVQ1VWt1vktv0sBsOQmAT9mCtj9
+INd6FIlbiu8BAJN9Z+W3AQAA
+`,
+	},
+
+	"/v1.1.0/image-manifest-schema.json": {
+		local:   "v1.1.0/image-manifest-schema.json",
+		size:    1295,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/7xTvW4UMRDu9ylGTspcDIhqW6oUiIKIBlEY7/huoux4mfEhTujeHdk+J2sC0umKXPnd
+fH8z3t8DgJlQvdCSKLIZwXxakD9ETo4YBe5mt0X46JgCaoLPC3oK5F2Zvsn0a/U7nF2m7lJaRmsfNPKm
+ordRtnYSF9LmzXtbsavKo6lRdLQ2Lsi+uWqh1WlLOYGdTwkqNx0WzOz4/QH9CVskLiiJUM0IuRiAqRJf
+ULSWq/DLzvc7UgiEjxNobYgKaYdQzKGZQ9WDn1UQnIJjIE64RTE3TfyyZrYP+6TWur6wmYlp3s9mhHfP
+mPvVsAId6z9mxoncfVX63xJy3zKXHSGGsgDBgILscYLVsvPPXAuGzJsw6KZpRbnN57+yEwZiytpqn927
+UE4SBefTGbna6OsG9JEDbdfRmmQ+KHL6W7Wn674GupT/6A4ouqa3t+BE3KF7CXcJ5zz69gmkE9LI57oD
+HPsrMcdUvvcuyoWPfK12waHW9KFlLUmN4I89CeZYX//19fc37Vc8AHwbjsOfAQA+PwVPDwUAAA==
+`,
+	},
+
+	"/v1.1.1/config-schema.json": {
+		local:   "v1.1.1/config-schema.json",
+		size:    3033,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/+RWzU7bQBC++ylGC0fAPfSUW0W5VaJS1PZQIbSxx8lQ7852doJqId69ckwgG/8QBdFL
+r5P5fvabWWcfMgBTYiyEghJ7MwNzHdBfsldLHgUu2Ve0hHnAgioq7KbrLAMwp7FYobMtZKUaZnl+F9mf
+d9ULlmVeiq30/MPHvKuddDgqt5A4y3MO6IutWtzAuu6cnF1iXmz0O6Q2AVssL+6w0K4WhAOKEkYzg4cM
+AMAUglaxfC7sQKMK+Y4OAMBULM5q+0tpFc+VHJoMAOCxazF2rSuWCaq0W4oVKRa6FjwUc2+FrNdD2zke
+3nlxjxK7sR6KqNC25gdFrIhtXrIjRbfbN0IO8JiIPE10gH9nrgDDswUAMN8iSlIZVX5WBQAwV38CRyy/
+smjcx58KVps1wCpetIt8kpdYkad24WPubJhvmK87j8P8/n7MVhrdSHyTB9nG2BdVaQJTskEAAIY9Xrdn
++rlThD25SYsTNl+xmtrdszzpwq/r2mRjPDeDEVy68r89+3eu1w7jkec/duvf+1Q/WH6RX36mo+75F7vA
++r0jmQ8M/j0jmSuHOS29rY+J5JMs41UsbMByDL5grtH6Hfzg51uYtYpv+XyXVFW3VMZ//6186p9KL5FF
+v3a9jTG1bVCiGZ5YtqdqBH+vSbBMeF4y2HeX7TJuM19RVJbmbf/Je+MZH9DgC+r1tKZeU9C/Hv2X1etD
+PRvweLto3sDBzqHX4wnQBW1uNxsxTtK7Wcl+prcse1Lo7036uHx5Dab3MgO4yR6zvwMABwYiGtkLAAA=
+`,
+	},
+
+	"/v1.1.1/content-descriptor.json": {
+		local:   "v1.1.1/content-descriptor.json",
+		size:    1374,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/6yUQW/UMBCF7/kVo7RSQerWHFY9RFWlCi5c4AA3xMGxJ/GUjW3Gs6oW1P+OHCfsBlDb
+XbGnzWjem89jPf+sAGqLyTBFoeDrBuqPEf3b4EWTR4b8D73Au6kpMHyKaKgjo0fFZbY4T8bhoLPcicRG
+qfsU/KpUrwL3yrLuZPVmrUrtrOjIzpLUKBUiejNPTqOsdCv7e3rRyS5iVob2Ho2UWuQQkYUw1Q3kgwHU
+A1rSn0tzKf19XnEIY182hdBBLjB2yOgNWjiYkX/1OWOXdRa7tNqDXeUTnymLHXnK3kntp4/ax2JRJ/rx
+HE9uAfLQ7gTTkUz/ACEv1+slhKUekzyDYXgXJfSsoyMDxqH5lrYDFO2MVVguM27+jFoE2cPFjd70gUnc
+cNvc5Iu1aG8vTtnjxLrg3/ImPUGvYUMFMTdCx2GAB0fGgThKEzMMegctgg0PfhO0RXsK3Uiy3K0W/RSb
+BxxatJZ8Py9RNPcoaMFMeXvV6oTXa5gW9/rFd110SyDNQp028oIkvL/7cFfiAPs8UILZ4j/mQHsfZHxE
+Fjd5/JugDp1O4DuUF8JqoqwZv2+JMSN9+fNJOYzzMlUVwNfqsfo1AM7KYZFeBQAA
+`,
+	},
+
+	"/v1.1.1/defs-descriptor.json": {
+		local:   "v1.1.1/defs-descriptor.json",
+		size:    844,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/5SST2/TTBDG7/kU826jt0DiOHBAqlWKKnrnUE6t0mi6O7aneP9od6IqVPnuaG03SYtA
+cLC1+2jmefwbz9MEQBlKOnIQ9k5VoK6oZsf5liBgFNabDiOIh6+B3BfvBNlRhKuxzUe4DqS5Zo29x3ww
+3buoCnIOgLJkGL9tA+0lAMUmp7YiIVVl6QM5/ZyRFj42ZdItWSzZYkOl2aeWB7f5s5cM3ipJZNcc9IAi
+FHu8u9vL4gaLH8vibHU4/ncy/f9uvZgVq6fl/P2Hj7vy78qmqo/YDUnKcENJjuleDVdaAh23QXwTMbSs
+Qbekv6eNhaEXfA25yN8/kJY5sOuvIwCcnmPX+MjS2ovqPI/KkLk4/ccJjFyzN5+r29liXaz2ytt3VT5f
+FjfL4uzTuljNXhFuYpf+wIfQ8QCRC6GO3sJjy7oFaTmNVGBxC/cExj+6zqMh8+v3Y4y4PcgsZI9zf08K
+oGofLea/oDaR1ajvXmCgc17w5XoCqGmkOvcZqtPiIXl3Uh4tcmkxXPdpw3uczCQ/u8nPAQABB2nETAMA
+AA==
+`,
+	},
+
+	"/v1.1.1/defs.json": {
+		local:   "v1.1.1/defs.json",
+		size:    1777,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/7STQY/bIBCF7/kVI9qj27UBg+1r23NW2mPVA+tMEqoNWBhLXa3y3ysShzg1rZTKGymW
+mRm+93jIbysAssG+dbrz2hrSAPmKW210WPUw9LgBv3d22O3t4MHvEdYdmi/WeKUNOnjqsNVb3arT9uzM
+iwDSQJAAINr4Kq4AiH/tMKhp43GHjmSXxkEbfRgOpIFPBa2uZfVrLBdUnorHLJILcS+aUSlS8FCf4Rm9
+F08LLnnFBE9pxOZMSPB7hWpKGZM0Z6IquZQiz/OEYmLqRnr4j9tJ6dCynHELsQBYlCWboxldAM1pzWsh
+aT3nC74Av6g4F5LzXDKZ12VJU+EX4tEGrpsKWoPrLWng+1iA2Ao/8tFh6JIPD5MP7mGMPA4es/Tuy2nM
+8PIymR7ffiSyWNKh4Ms6fFY9pm+r906b3eSycKPVZDBs1ka512+mtZsw2kTcaip5kToD7w/jD0OLHv+g
+uqcT9vxM5WCff2Lrrzl0ynt05tHZDp3X2N9m8vmtyI43pX8dIRlUNLU+S7+zqZH1N1Or8D+ufg8ACJCd
+FfEGAAA=
+`,
+	},
+
+	"/v1.1.1/image-index-schema.json": {
+		local:   "v1.1.1/image-index-schema.json",
+		size:    3367,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/7yWv27jOBDGez3FgAmQxokOh+AKI0hz16S6YoNtFikYcmRN1iK15DiJd+F3X1C0ZMqS
+Hcc2Nk3g4cw3v4//xF8ZgNDolaOayRoxBfF/jeZfa1iSQQcPlZwhPBiN7/ClRkUFKdmkTkLtpVclVjLU
+lcz1NM9fvDXXMXpj3SzXThZ8/ddtHmMXsY50W+KneW5rNKpt6ZuymJ1TaJ9TaB8LeVljKLXPL6g4xmpn
+a3RM6MUUgiUAEeu/ovPRVgwP3T6W5KEgnGvw0R564BKh6QxNZ4hi8BrVQHqQBsgwztCJSat8hKe8j9lJ
+tS4HPSoyVC0qMYW/NzH53saa0CqOiAo1yceotMt+cNrkhY5gi8a6wwIdGoUakmkOf+LSYRHqNBb+utWy
+7ias+kWusSBDQdvnm+49KOmYCqn4AK429c8C+kVUTNhazbCcaHhbtl9fSUMFevapQrue0jm5THYMY5Xm
+fXoTtc3+64g68fGzsh5x+GNBDkOvb120t2UmadjTz62Iphl6Fl3oKREfOY4D+f7Ayfvy1MUHSJYwNX0I
+Z0gEMvC8ZPRHsY4AkuF/bnfDref/EDzlljXbmZN1SQpUieq7X1QQFVrcyDgBMs3PWjKjM3B1J+cz64jL
+6n56F/aiRn1/dfy8b++bbV8LN/cfupIwp4ge0qFwtoK3klQJHG7z6AUquYRnBG3fzNxKjfp46oZqJ3M9
+l1xYVw25P3eYO50tzp3HeN9RXl+2qiRGxQuHW3UAwvY89c7w/nM81B6OH+0+3wudTIdnR2YmthJWYzbP
+iWf9eaBuXgdvk3PAdbLngSxQhnU49xRudPdg9j+WadvBZ/NgkwCrD22/SkfS8LjlD+Yw2/Wr10ZIYyw3
+z2h/6q2xubjyVPXouy4Vyca8rLL0f/euG3V01Jt4zMYpBlbZGnN4V4qx93fyhMsAnrJV9nsAHZlsRicN
+AAA=
+`,
+	},
+
+	"/v1.1.1/image-layout-schema.json": {
+		local:   "v1.1.1/image-layout-schema.json",
+		size:    439,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/2yPQUvEMBCF7/0VQ/SgsG0qeMp1TwvCHgQv4qG203aWbRKTqbBI/7sk0yrinsK8mS/v
+va8CQHUY20CeyVllQB092r2z3JDFAIepGRCemoubGZ7bEadG7RJ1G2UwoEZmb7Q+RWdLUSsXBt2Fpuey
+ftSi3QhH3YZEo7XzaNvNLGZMrjUlY33OxkLyxWNi3fsJ21XzwXkMTBiVgdQmOSRSEr9giFJLdv/bfsoF
+uB54RDjuD38r35HNC9dSKWGgpzPeq9324RYrciA7/Opo50kZeF1nAPVQ1VWt1vktv0sBsOQmAT9mCtj9
+INd6FIlbiu8BAJN9Z+W3AQAA
+`,
+	},
+
+	"/v1.1.1/image-manifest-schema.json": {
+		local:   "v1.1.1/image-manifest-schema.json",
+		size:    1295,
+		modtime: 1498025574,
+		compressed: `
+H4sIAAAAAAAC/7xTvW4UMRDu9ylGTspcDIhqW6oUiIKIBlEY7/huoux4mfEhTujeHdk+J2sC0umKXPnd
+fH8z3t8DgJlQvdCSKLIZwXxakD9ETo4YBe5mt0X46JgCaoLPC3oK5F2Zvsn0a/U7nF2m7lJaRmsfNPKm
+ordRtnYSF9LmzXtbsavKo6lRdLQ2Lsi+uWqh1WlLOYGdTwkqNx0WzOz4/QH9CVskLiiJUM0IuRiAqRJf
+ULSWq/DLzvc7UgiEjxNobYgKaYdQzKGZQ9WDn1UQnIJjIE64RTE3TfyyZrYP+6TWur6wmYlp3s9mhHfP
+mPvVsAId6z9mxoncfVX63xJy3zKXHSGGsgDBgILscYLVsvPPXAuGzJsw6KZpRbnN57+yEwZiytpqn927
+UE4SBefTGbna6OsG9JEDbdfRmmQ+KHL6W7Wn674GupT/6A4ouqa3t+BE3KF7CXcJ5zz69gmkE9LI57oD
+HPsrMcdUvvcuyoWPfK12waHW9KFlLUmN4I89CeZYX//19fc37Vc8AHwbjsOfAQA+PwVPDwUAAA==
+`,
+	},
+
 	"/": {
 		isDir: true,
 		local: "/",
 	},
+
+	"/v1.1.0": {
+		isDir: true,
+		local: "v1.1.0",
+	},
+
+	"/v1.1.1": {
+		isDir: true,
+		local: "v1.1.1",
+	},
 }
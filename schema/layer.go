@@ -0,0 +1,169 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Whiteout file name prefixes, see layer.md.
+const (
+	whiteoutPrefix     = ".wh."
+	whiteoutMetaPrefix = whiteoutPrefix + whiteoutPrefix
+	whiteoutOpaqueDir  = whiteoutMetaPrefix + ".opq"
+)
+
+// layerValidators maps the layer media types to whether the tar archive
+// is gzip compressed.
+var layerValidators = map[Validator]bool{
+	ValidatorMediaTypeImageLayer:                     false,
+	ValidatorMediaTypeImageLayerGzip:                 true,
+	ValidatorMediaTypeImageLayerNonDistributable:     false,
+	ValidatorMediaTypeImageLayerNonDistributableGzip: true,
+}
+
+// layerEntry is what validateLayer remembers about a processed entry.
+type layerEntry struct {
+	typeflag byte
+}
+
+// validateLayer streams the layer tar archive from r and checks
+// the entries against the rules of layer.md.
+// All violations are collected into a ValidationError.
+func validateLayer(r io.Reader, gzipped bool, rep *report) error {
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return errors.Wrap(err, "layer is not gzip compressed")
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var errs []error
+	fail := func(name string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("entry %q: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	entries := map[string]layerEntry{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to read the layer tar archive")
+		}
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			// pax global headers hold no file, as written by git archive
+			continue
+		}
+
+		name, ok := layerPath(hdr.Name)
+		if !ok {
+			fail(hdr.Name, "path escapes the root filesystem")
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		case tar.TypeLink:
+			target, ok := layerPath(hdr.Linkname)
+			if !ok {
+				fail(hdr.Name, "hardlink target %q escapes the root filesystem", hdr.Linkname)
+				break
+			}
+			entry, ok := entries[target]
+			if !ok {
+				fail(hdr.Name, "hardlink target %q is not an earlier entry", hdr.Linkname)
+			} else if entry.typeflag == tar.TypeDir {
+				fail(hdr.Name, "hardlink target %q is a directory", hdr.Linkname)
+			}
+		case tar.TypeGNUSparse:
+			rep.add(Finding{
+				Rule:    RuleLayerSparseFile,
+				Message: fmt.Sprintf("entry %q: sparse files should not be used", hdr.Name),
+			})
+		default:
+			fail(hdr.Name, "unsupported entry type %q", hdr.Typeflag)
+		}
+
+		base := path.Base(name)
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			if err := checkWhiteout(base, hdr); err != nil {
+				fail(hdr.Name, "%v", err)
+			}
+		}
+
+		if _, ok := entries[name]; ok {
+			fail(hdr.Name, "duplicate entry")
+		}
+		entries[name] = layerEntry{typeflag: hdr.Typeflag}
+
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return errors.Wrapf(err, "unable to read entry %q", hdr.Name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return ValidationError{Errs: errs}
+	}
+	return nil
+}
+
+// layerPath returns the cleaned, relative form of a tar entry name.
+// The second return value is false if the name is absolute or
+// refers to a path outside of the root filesystem.
+func layerPath(name string) (string, bool) {
+	if path.IsAbs(name) {
+		return "", false
+	}
+	name = path.Clean(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// checkWhiteout checks a tar entry whose base name has the whiteout prefix.
+func checkWhiteout(base string, hdr *tar.Header) error {
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return errors.New("whiteout is not a regular file")
+	}
+	if hdr.Size != 0 {
+		return errors.New("whiteout is not empty")
+	}
+	if base == whiteoutOpaqueDir {
+		return nil
+	}
+	if strings.HasPrefix(base, whiteoutMetaPrefix) {
+		return errors.New("unknown whiteout meta entry")
+	}
+	switch strings.TrimPrefix(base, whiteoutPrefix) {
+	case "", ".", "..":
+		return errors.New("whiteout does not name a path")
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+)
+
+func TestLayer(t *testing.T) {
+	for i, tt := range []struct {
+		entries []tar.Header
+		fail    bool
+	}{
+		// valid layer from layer.md
+		{
+			entries: []tar.Header{
+				{Name: "./etc/my-app.d/", Typeflag: tar.TypeDir},
+				{Name: "./etc/my-app.d/default.cfg", Typeflag: tar.TypeReg},
+				{Name: "./bin/my-app-tools", Typeflag: tar.TypeReg},
+				{Name: "./etc/.wh.my-app-config", Typeflag: tar.TypeReg},
+			},
+			fail: false,
+		},
+
+		// valid layer with an opaque whiteout, symlinks, hardlinks and devices
+		{
+			entries: []tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "a/.wh..wh..opq", Typeflag: tar.TypeReg},
+				{Name: "a/b", Typeflag: tar.TypeReg},
+				{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "./a/b"},
+				{Name: "a/d", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+				{Name: "dev/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3},
+				{Name: "fifo", Typeflag: tar.TypeFifo},
+			},
+			fail: false,
+		},
+
+		// valid layer with a pax global header
+		{
+			entries: []tar.Header{
+				{Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123456789abcdef"}},
+				{Name: "a", Typeflag: tar.TypeReg},
+			},
+			fail: false,
+		},
+
+		// expected failure: duplicate entry
+		{
+			entries: []tar.Header{
+				{Name: "a/b", Typeflag: tar.TypeReg},
+				{Name: "./a/b", Typeflag: tar.TypeReg},
+			},
+			fail: true,
+		},
+
+		// expected failure: path escapes the root
+		{
+			entries: []tar.Header{
+				{Name: "a/../../b", Typeflag: tar.TypeReg},
+			},
+			fail: true,
+		},
+
+		// expected failure: absolute path
+		{
+			entries: []tar.Header{
+				{Name: "/etc/passwd", Typeflag: tar.TypeReg},
+			},
+			fail: true,
+		},
+
+		// expected failure: hardlink to a later entry
+		{
+			entries: []tar.Header{
+				{Name: "a", Typeflag: tar.TypeLink, Linkname: "b"},
+				{Name: "b", Typeflag: tar.TypeReg},
+			},
+			fail: true,
+		},
+
+		// expected failure: hardlink to a directory
+		{
+			entries: []tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "b", Typeflag: tar.TypeLink, Linkname: "a"},
+			},
+			fail: true,
+		},
+
+		// expected failure: hardlink escaping the root
+		{
+			entries: []tar.Header{
+				{Name: "b", Typeflag: tar.TypeLink, Linkname: "../a"},
+			},
+			fail: true,
+		},
+
+		// expected failure: whiteout is a directory
+		{
+			entries: []tar.Header{
+				{Name: "a/.wh.b/", Typeflag: tar.TypeDir},
+			},
+			fail: true,
+		},
+
+		// expected failure: whiteout without a name
+		{
+			entries: []tar.Header{
+				{Name: "a/.wh.", Typeflag: tar.TypeReg},
+			},
+			fail: true,
+		},
+
+		// expected failure: unknown whiteout meta entry
+		{
+			entries: []tar.Header{
+				{Name: "a/.wh..wh.plnk", Typeflag: tar.TypeReg},
+			},
+			fail: true,
+		},
+
+		// expected failure: unsupported entry type
+		{
+			entries: []tar.Header{
+				{Name: "a", Typeflag: tar.TypeCont},
+			},
+			fail: true,
+		},
+	} {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, hdr := range tt.entries {
+			hdr := hdr
+			if hdr.Typeflag != tar.TypeXGlobalHeader {
+				hdr.Mode = 0644
+			}
+			if err := tw.WriteHeader(&hdr); err != nil {
+				t.Fatalf("test %d: %v", i, err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+
+		gzbuf := &bytes.Buffer{}
+		gw := gzip.NewWriter(gzbuf)
+		if _, err := gw.Write(buf.Bytes()); err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+
+		for _, v := range []struct {
+			validator schema.Validator
+			layer     []byte
+		}{
+			{schema.ValidatorMediaTypeImageLayer, buf.Bytes()},
+			{schema.ValidatorMediaTypeImageLayerGzip, gzbuf.Bytes()},
+			{schema.ValidatorMediaTypeImageLayerNonDistributable, buf.Bytes()},
+			{schema.ValidatorMediaTypeImageLayerNonDistributableGzip, gzbuf.Bytes()},
+		} {
+			err := v.validator.Validate(bytes.NewReader(v.layer))
+
+			if got := err != nil; tt.fail != got {
+				t.Errorf("test %d (%s): expected validation failure %t but got %t, err %v", i, v.validator, tt.fail, got, err)
+			}
+		}
+	}
+
+	// expected failure: gzip layer media type with an uncompressed layer
+	if err := schema.ValidatorMediaTypeImageLayerGzip.Validate(bytes.NewReader([]byte("not gzip"))); err == nil {
+		t.Error("expected validation failure for an uncompressed gzip layer")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"go4.org/errorutil"
+)
+
+// Options configures a validation run.
+// The zero value is ready to use.
+type Options struct {
+	// Warn, if set, is called for every warning as soon as it is found.
+	// Warnings are returned by ValidateWithOptions either way.
+	Warn func(Finding)
+
+	// Strict promotes every rule violation to an error.
+	Strict bool
+
+	// Allow lists the rules which stay warnings in strict mode.
+	Allow []Rule
+
+	// Version selects the release of the specification whose JSON schemas
+	// documents are validated against, for example "1.1.0".
+	// The empty string selects specs.Version. See Versions.
+	Version string
+}
+
+// report collects the warnings of a single validation run.
+type report struct {
+	buf      []byte
+	opts     Options
+	warnings []Finding
+	errors   []Finding
+}
+
+func newReport(buf []byte, opts Options) *report {
+	return &report{
+		buf:  buf,
+		opts: opts,
+	}
+}
+
+// warnf records a violation of rule by the value addressed
+// by the JSON Pointer reference tokens.
+func (r *report) warnf(rule Rule, tokens []string, actual interface{}, format string, args ...interface{}) {
+	f := Finding{
+		Pointer: pointerString(tokens),
+		Rule:    rule,
+		Actual:  actual,
+		Message: fmt.Sprintf(format, args...),
+	}
+	f.locate(r.buf, tokens)
+	r.add(f)
+}
+
+// warnAtf records a violation of rule at the given byte offset of the document.
+func (r *report) warnAtf(rule Rule, offset int64, format string, args ...interface{}) {
+	f := Finding{
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+		Offset:  offset,
+	}
+	f.Line, f.Col, _ = errorutil.HighlightBytePosition(bytes.NewReader(r.buf), offset)
+	r.add(f)
+}
+
+func (r *report) add(f Finding) {
+	if r.opts.Strict && !r.opts.allowed(f.Rule) {
+		f.Severity = SeverityError
+		r.errors = append(r.errors, f)
+		return
+	}
+
+	f.Severity = SeverityWarning
+	r.warnings = append(r.warnings, f)
+	if r.opts.Warn != nil {
+		r.opts.Warn(f)
+	}
+}
+
+// merge adds the rule violations promoted to errors to the result err
+// of the validation run. Other errors than a ValidationError are kept
+// as the first error of the returned ValidationError.
+func (r *report) merge(err error) error {
+	if len(r.errors) == 0 {
+		return err
+	}
+
+	verr := ValidationError{}
+	if err != nil {
+		var ok bool
+		if verr, ok = errors.Cause(err).(ValidationError); !ok {
+			verr = ValidationError{Errs: []error{err}}
+		}
+	}
+
+	for _, f := range r.errors {
+		verr.Errs = append(verr.Errs, f)
+		verr.Findings = append(verr.Findings, f)
+	}
+	return verr
+}
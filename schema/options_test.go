@@ -0,0 +1,246 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+func TestValidateWithOptionsWarnings(t *testing.T) {
+	for i, tt := range []struct {
+		validator schema.Validator
+		document  string
+		pointers  []string
+	}{
+		// no warnings
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			document: `
+{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "size": 1470,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ]
+}
+`,
+		},
+
+		// unknown config and layer media types
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			document: `
+{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.example.config+json",
+    "size": 1470,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    },
+    {
+      "mediaType": "application/vnd.example.layer",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ]
+}
+`,
+			pointers: []string{"/config/mediaType", "/layers/1/mediaType"},
+		},
+
+		// unknown platform in an index
+		{
+			validator: schema.ValidatorMediaTypeImageIndex,
+			document: `
+{
+  "schemaVersion": 2,
+  "manifests": [
+    {
+      "mediaType": "application/vnd.oci.image.manifest.v1+json",
+      "size": 7143,
+      "digest": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+      "platform": {
+        "architecture": "ppc64le",
+        "os": "beos"
+      }
+    },
+    {
+      "mediaType": "application/vnd.oci.image.manifest.v1+json",
+      "size": 7682,
+      "digest": "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+      "platform": {
+        "architecture": "ppc64le",
+        "os": "windows"
+      }
+    }
+  ]
+}
+`,
+			pointers: []string{"/manifests/0/platform/os", "/manifests/1/platform/architecture"},
+		},
+	} {
+		var called []string
+		opts := schema.Options{
+			Warn: func(f schema.Finding) {
+				if f.Rule != schema.RuleCanonicalJSON {
+					called = append(called, f.Pointer)
+				}
+			},
+		}
+
+		warnings, _ := tt.validator.ValidateWithOptions(strings.NewReader(tt.document), opts)
+
+		var pointers []string
+		for _, w := range warnings {
+			if w.Rule == schema.RuleCanonicalJSON {
+				continue
+			}
+			if w.Severity != schema.SeverityWarning {
+				t.Errorf("test %d: expected severity %v but got %v", i, schema.SeverityWarning, w.Severity)
+			}
+			if w.Line == 0 {
+				t.Errorf("test %d: warning %v is not located", i, w)
+			}
+			pointers = append(pointers, w.Pointer)
+		}
+
+		if !reflect.DeepEqual(pointers, tt.pointers) {
+			t.Errorf("test %d: expected warnings at %v but got %v", i, tt.pointers, pointers)
+		}
+		if !reflect.DeepEqual(called, tt.pointers) {
+			t.Errorf("test %d: expected callbacks for %v but got %v", i, tt.pointers, called)
+		}
+	}
+}
+
+func TestValidateWithOptionsStrict(t *testing.T) {
+	for i, tt := range []struct {
+		layout string
+		opts   schema.Options
+		rules  []schema.Rule
+		fail   bool
+	}{
+		// canonical document
+		{
+			layout: `{"imageLayoutVersion":"1.0.0"}`,
+			opts:   schema.Options{Strict: true},
+		},
+
+		// non-canonical document is a warning by default
+		{
+			layout: `{"imageLayoutVersion": "1.0.0"}`,
+			rules:  []schema.Rule{schema.RuleCanonicalJSON},
+		},
+
+		// expected failure: non-canonical document in strict mode
+		{
+			layout: `{"imageLayoutVersion": "1.0.0"}`,
+			opts:   schema.Options{Strict: true},
+			fail:   true,
+		},
+
+		// non-canonical document in strict mode with the rule allowed
+		{
+			layout: `{"imageLayoutVersion": "1.0.0"}`,
+			opts: schema.Options{
+				Strict: true,
+				Allow:  []schema.Rule{schema.RuleCanonicalJSON},
+			},
+			rules: []schema.Rule{schema.RuleCanonicalJSON},
+		},
+
+		// expected failure: schema violations are reported next to promoted warnings
+		{
+			layout: `{"imageLayoutVersion": 1}`,
+			opts:   schema.Options{Strict: true},
+			fail:   true,
+		},
+	} {
+		warnings, err := schema.ValidatorMediaTypeLayoutHeader.ValidateWithOptions(strings.NewReader(tt.layout), tt.opts)
+
+		if got := err != nil; tt.fail != got {
+			t.Errorf("test %d: expected validation failure %t but got %t, err %v", i, tt.fail, got, err)
+		}
+
+		var rules []schema.Rule
+		for _, w := range warnings {
+			rules = append(rules, w.Rule)
+		}
+		if !reflect.DeepEqual(rules, tt.rules) {
+			t.Errorf("test %d: expected warnings for %v but got %v", i, tt.rules, rules)
+		}
+
+		if !tt.fail || !tt.opts.Strict {
+			continue
+		}
+
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok {
+			t.Errorf("test %d: expected a validation error but got %v", i, err)
+			continue
+		}
+
+		var found bool
+		for _, f := range verr.Findings {
+			if f.Rule == schema.RuleCanonicalJSON {
+				found = true
+				if f.Severity != schema.SeverityError {
+					t.Errorf("test %d: expected severity %v but got %v", i, schema.SeverityError, f.Severity)
+				}
+				if f.Offset != 22 {
+					t.Errorf("test %d: expected first difference at byte 22 but got %d", i, f.Offset)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("test %d: expected a %s finding in %v", i, schema.RuleCanonicalJSON, verr.Findings)
+		}
+	}
+}
+
+func TestValidateWithOptionsStrictOtherError(t *testing.T) {
+	config := `{"architecture":"amd64","os":"unknown","rootfs":{"type":"layers","diff_ids":[]},"config":{"Env":["invalid"]}}`
+	_, err := schema.ValidatorMediaTypeImageConfig.ValidateWithOptions(strings.NewReader(config), schema.Options{Strict: true})
+
+	verr, ok := errors.Cause(err).(schema.ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+	if len(verr.Errs) != 2 || !strings.Contains(verr.Errs[0].Error(), "unexpected env") {
+		t.Errorf("expected the env error first in %v", verr.Errs)
+	}
+	if len(verr.Findings) != 1 || verr.Findings[0].Rule != schema.RulePlatform {
+		t.Errorf("expected a %s finding but got %v", schema.RulePlatform, verr.Findings)
+	}
+}
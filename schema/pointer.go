@@ -0,0 +1,173 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// pointerOffset returns the byte offset in buf of the JSON value
+// addressed by the given JSON Pointer reference tokens.
+// The second return value is false if the value could not be found.
+func pointerOffset(buf []byte, tokens []string) (int64, bool) {
+	s := &scanner{buf: buf}
+	s.skipSpace()
+	for _, token := range tokens {
+		if !s.descend(token) {
+			return 0, false
+		}
+	}
+	return int64(s.pos), s.pos < len(buf)
+}
+
+// scanner walks a JSON document without decoding it.
+// It assumes the document is syntactically valid
+// and gives up as soon as it finds otherwise.
+type scanner struct {
+	buf []byte
+	pos int
+}
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.buf) {
+		switch s.buf[s.pos] {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// expect consumes c and any following whitespace.
+func (s *scanner) expect(c byte) bool {
+	if s.pos >= len(s.buf) || s.buf[s.pos] != c {
+		return false
+	}
+	s.pos++
+	s.skipSpace()
+	return true
+}
+
+// descend moves from the current object or array to the member
+// addressed by token.
+func (s *scanner) descend(token string) bool {
+	if s.pos >= len(s.buf) {
+		return false
+	}
+
+	switch s.buf[s.pos] {
+	case '{':
+		s.expect('{')
+		for s.pos < len(s.buf) && s.buf[s.pos] != '}' {
+			start := s.pos
+			if !s.skipString() {
+				return false
+			}
+			var key string
+			if err := json.Unmarshal(s.buf[start:s.pos], &key); err != nil {
+				return false
+			}
+			s.skipSpace()
+			if !s.expect(':') {
+				return false
+			}
+			if key == token {
+				return true
+			}
+			if !s.skipValue() || !s.next() {
+				return false
+			}
+		}
+	case '[':
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 {
+			return false
+		}
+		s.expect('[')
+		for i := 0; s.pos < len(s.buf) && s.buf[s.pos] != ']'; i++ {
+			if i == index {
+				return true
+			}
+			if !s.skipValue() || !s.next() {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// next consumes the separator after an object member or array element.
+func (s *scanner) next() bool {
+	s.skipSpace()
+	if s.pos < len(s.buf) && (s.buf[s.pos] == '}' || s.buf[s.pos] == ']') {
+		return true
+	}
+	return s.expect(',')
+}
+
+// skipString consumes a JSON string starting at the current position.
+func (s *scanner) skipString() bool {
+	if s.pos >= len(s.buf) || s.buf[s.pos] != '"' {
+		return false
+	}
+	for s.pos++; s.pos < len(s.buf); s.pos++ {
+		switch s.buf[s.pos] {
+		case '\\':
+			s.pos++
+		case '"':
+			s.pos++
+			return true
+		}
+	}
+	return false
+}
+
+// skipValue consumes the JSON value starting at the current position.
+func (s *scanner) skipValue() bool {
+	depth := 0
+	for s.pos < len(s.buf) {
+		switch s.buf[s.pos] {
+		case '"':
+			if !s.skipString() {
+				return false
+			}
+		case '{', '[':
+			depth++
+			s.pos++
+		case '}', ']':
+			depth--
+			s.pos++
+		case ',', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				return true
+			}
+			s.pos++
+		default:
+			s.pos++
+		}
+		if depth == 0 && s.pos < len(s.buf) {
+			switch s.buf[s.pos] {
+			case ',', '}', ']', ' ', '\t', '\r', '\n':
+				return true
+			}
+		}
+		if depth < 0 {
+			return false
+		}
+	}
+	return depth == 0
+}
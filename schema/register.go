@@ -0,0 +1,107 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// CheckFunc is a semantic check run on a document
+// before it is validated against its JSON schema.
+type CheckFunc func(r io.Reader) error
+
+// registration holds a Validator added with Register or RegisterSchema.
+type registration struct {
+	loader func() gojsonschema.JSONLoader
+	check  validateFunc
+}
+
+var (
+	registryMu sync.RWMutex
+
+	// registry maps custom media types to their registration.
+	registry = map[Validator]registration{}
+)
+
+// Register adds a Validator for the custom media type mediaType.
+// Documents are validated against the JSON schema stored as file in fs,
+// which may refer to other schema files in fs. If check is not nil,
+// it is run on every document before the schema validation.
+//
+// Registering one of the OCI media types, or a media type which is
+// already registered, fails, as does registering a schema which cannot
+// be loaded or is no valid JSON schema.
+func Register(mediaType string, fs http.FileSystem, file string, check CheckFunc) (Validator, error) {
+	if fs == nil {
+		return "", errors.New("schema file system is nil")
+	}
+	loader := func() gojsonschema.JSONLoader {
+		return gojsonschema.NewReferenceLoaderFileSystem("file:///"+file, fs)
+	}
+	if _, err := gojsonschema.NewSchema(loader()); err != nil {
+		return "", errors.Wrapf(err, "schema %s: invalid JSON schema %s", mediaType, file)
+	}
+	return register(mediaType, loader, check)
+}
+
+// RegisterSchema adds a Validator for the custom media type mediaType,
+// validating documents against the given JSON schema document.
+// See Register for the meaning of check.
+func RegisterSchema(mediaType string, schema []byte, check CheckFunc) (Validator, error) {
+	schema = append([]byte(nil), schema...)
+	if _, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(string(schema))); err != nil {
+		return "", errors.Wrapf(WrapSyntaxError(bytes.NewReader(schema), err), "schema %s: invalid JSON schema", mediaType)
+	}
+	return register(mediaType, func() gojsonschema.JSONLoader {
+		return gojsonschema.NewStringLoader(string(schema))
+	}, check)
+}
+
+func register(mediaType string, loader func() gojsonschema.JSONLoader, check CheckFunc) (Validator, error) {
+	v := Validator(mediaType)
+	if _, ok := specs[v]; ok || v.isLayer() {
+		return "", errors.Errorf("schema %s: cannot replace an OCI media type", v)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[v]; ok {
+		return "", errors.Errorf("schema %s: already registered", v)
+	}
+
+	r := registration{loader: loader}
+	if check != nil {
+		r.check = func(r io.Reader, _ *report) error {
+			return check(r)
+		}
+	}
+	registry[v] = r
+	return v, nil
+}
+
+// registered returns the registration of v, if any.
+func (v Validator) registered() (registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[v]
+	return r, ok
+}
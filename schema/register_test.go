@@ -0,0 +1,166 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const modelConfigSchema = `{
+  "$schema": "http://json-schema.org/draft-04/schema#",
+  "type": "object",
+  "properties": {
+    "name": {
+      "type": "string"
+    },
+    "parameters": {
+      "type": "integer",
+      "minimum": 1
+    }
+  },
+  "required": [
+    "name"
+  ]
+}`
+
+type modelConfig struct {
+	Name       string `json:"name"`
+	Parameters int    `json:"parameters,omitempty"`
+}
+
+func checkModelConfig(r io.Reader) error {
+	var config modelConfig
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return err
+	}
+	if strings.ToLower(config.Name) != config.Name {
+		return errors.Errorf("model name %q is not lower case", config.Name)
+	}
+	return nil
+}
+
+func TestRegisterSchema(t *testing.T) {
+	const mediaType = "application/vnd.example.model.config.v1+json"
+	v, err := schema.RegisterSchema(mediaType, []byte(modelConfigSchema), checkModelConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		config  string
+		fail    bool
+		pointer string
+	}{
+		// valid config
+		{
+			config: `{"name":"resnet","parameters":25000000}`,
+		},
+
+		// expected failure: name is missing
+		{
+			config:  `{"parameters":25000000}`,
+			fail:    true,
+			pointer: "",
+		},
+
+		// expected failure: parameters is below the minimum
+		{
+			config:  `{"name":"resnet","parameters":0}`,
+			fail:    true,
+			pointer: "/parameters",
+		},
+
+		// expected failure: semantic check
+		{
+			config: `{"name":"ResNet"}`,
+			fail:   true,
+		},
+	} {
+		err := v.Validate(strings.NewReader(tt.config))
+		if got := err != nil; tt.fail != got {
+			t.Errorf("test %d: expected validation failure %t but got %t, err %v", i, tt.fail, got, err)
+		}
+
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok {
+			continue
+		}
+		if len(verr.Findings) != 1 || verr.Findings[0].Pointer != tt.pointer {
+			t.Errorf("test %d: expected a finding at %q but got %v", i, tt.pointer, verr.Findings)
+		}
+	}
+
+	if _, err := schema.RegisterSchema(mediaType, []byte(modelConfigSchema), nil); err == nil {
+		t.Error("expected registering a media type twice to fail")
+	}
+	if _, err := schema.RegisterSchema(v1.MediaTypeImageConfig, []byte(modelConfigSchema), nil); err == nil {
+		t.Error("expected registering an OCI media type to fail")
+	}
+	if _, err := schema.RegisterSchema("application/vnd.example.invalid+json", []byte(`{"type": 1}`), nil); err == nil {
+		t.Error("expected registering an invalid schema to fail")
+	}
+
+	// registered config types are validated by ValidateContent
+	blobs := memoryBlobs{}
+	config := blobs.add(mediaType, []byte(`{"name":"ResNet"}`))
+	manifest := blobs.addJSON(t, v1.MediaTypeImageManifest, v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    config,
+		Layers:    []v1.Descriptor{},
+	})
+	if _, err := schema.ValidateContent(manifest, blobs, schema.Options{}); err == nil || !strings.Contains(err.Error(), "not lower case") {
+		t.Errorf("expected the registered config to be validated, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	v, err := schema.Register("application/vnd.example.layout+json", schema.FileSystem(), "image-layout-schema.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Validate(strings.NewReader(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := v.Validate(strings.NewReader(`{"imageLayoutVersion":1}`)); err == nil {
+		t.Error("expected validation failure")
+	}
+
+	dir, err := ioutil.TempDir("", "schema-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "invalid.json"), []byte(`{"type": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"invalid.json", "missing.json"} {
+		if _, err := schema.Register("application/vnd.example."+file, http.Dir(dir), file, nil); err == nil {
+			t.Errorf("expected registering %s to fail", file)
+		}
+	}
+}
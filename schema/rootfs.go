@@ -0,0 +1,155 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ValidateRootFS checks that the layers of manifest are consistent with
+// the rootfs and history of config, the image configuration the manifest
+// refers to:
+//
+//   - the number of layers matches the number of rootfs.diff_ids,
+//   - the number of history entries which are not marked as empty_layer
+//     matches the number of layers, if there is any history,
+//   - the DiffID of every layer, the digest of its uncompressed content,
+//     matches the rootfs.diff_ids entry at the same position.
+//
+// The DiffIDs of uncompressed layers are their digests. The DiffIDs of
+// other layers are computed from the layer blobs, which are fetched from
+// blobs. If blobs is nil, the DiffIDs of those layers are not checked.
+//
+// Mismatches are reported as a ValidationError, whose findings point
+// into the image configuration.
+func ValidateRootFS(manifest v1.Manifest, config v1.Image, blobs BlobProvider) error {
+	var findings []Finding
+	fail := func(tokens []string, actual interface{}, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Pointer:  pointerString(tokens),
+			Actual:   actual,
+			Message:  fmt.Sprintf(format, args...),
+			Severity: SeverityError,
+		})
+	}
+
+	diffIDs := config.RootFS.DiffIDs
+	if len(manifest.Layers) != len(diffIDs) {
+		fail([]string{"rootfs", "diff_ids"}, len(diffIDs),
+			"%d diff_ids do not match the %d layers of the manifest", len(diffIDs), len(manifest.Layers))
+	}
+
+	if len(config.History) > 0 {
+		var layers int
+		for _, h := range config.History {
+			if !h.EmptyLayer {
+				layers++
+			}
+		}
+		if layers != len(manifest.Layers) {
+			fail([]string{"history"}, layers,
+				"%d non-empty history entries do not match the %d layers of the manifest", layers, len(manifest.Layers))
+		}
+	}
+
+	positions := map[digest.Digest]int{}
+	for i, diffID := range diffIDs {
+		positions[diffID] = i
+	}
+
+	for i, layer := range manifest.Layers {
+		if i >= len(diffIDs) {
+			break
+		}
+
+		diffID, err := layerDiffID(layer, diffIDs[i].Algorithm(), blobs)
+		if err != nil {
+			fail([]string{"rootfs", "diff_ids", strconv.Itoa(i)}, diffIDs[i].String(),
+				"unable to compute the DiffID of layer %s: %v", layer.Digest, err)
+			continue
+		}
+		if diffID == "" || diffID == diffIDs[i] {
+			continue
+		}
+
+		if j, ok := positions[diffID]; ok {
+			fail([]string{"rootfs", "diff_ids", strconv.Itoa(i)}, diffIDs[i].String(),
+				"layer %d has the DiffID of diff_ids entry %d: layers are out of order", i, j)
+		} else {
+			fail([]string{"rootfs", "diff_ids", strconv.Itoa(i)}, diffIDs[i].String(),
+				"layer %s has DiffID %s", layer.Digest, diffID)
+		}
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+
+	errs := make([]error, 0, len(findings))
+	for _, f := range findings {
+		errs = append(errs, f)
+	}
+	return ValidationError{
+		Errs:     errs,
+		Findings: findings,
+	}
+}
+
+// layerDiffID returns the DiffID of layer using the algorithm alg.
+// It returns an empty digest if the DiffID cannot be computed without blobs.
+func layerDiffID(layer v1.Descriptor, alg digest.Algorithm, blobs BlobProvider) (digest.Digest, error) {
+	if !alg.Available() {
+		return "", errors.Errorf("unsupported digest algorithm %q", alg)
+	}
+
+	gzipped, known := layerValidators[Validator(layer.MediaType)]
+	if known && !gzipped && layer.Digest.Algorithm() == alg {
+		return layer.Digest, nil
+	}
+	if blobs == nil {
+		return "", nil
+	}
+
+	rc, err := blobs.Get(layer.Digest)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	return uncompressedDigest(rc, alg)
+}
+
+// uncompressedDigest digests the content of r using the algorithm alg,
+// decompressing it first if it is gzip compressed.
+func uncompressedDigest(r io.Reader, alg digest.Algorithm) (digest.Digest, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		return alg.FromReader(gz)
+	}
+	return alg.FromReader(br)
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func gzipLayer(t *testing.T, p []byte) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateRootFS(t *testing.T) {
+	blobs := memoryBlobs{}
+
+	tarA := tarLayer(t, tar.Header{Name: "a", Typeflag: tar.TypeReg})
+	tarB := tarLayer(t, tar.Header{Name: "b", Typeflag: tar.TypeReg})
+	plainA := blobs.add(v1.MediaTypeImageLayer, tarA)
+	gzipA := blobs.add(v1.MediaTypeImageLayerGzip, gzipLayer(t, tarA))
+	gzipB := blobs.add(v1.MediaTypeImageLayerGzip, gzipLayer(t, tarB))
+	diffA := digest.FromBytes(tarA)
+	diffB := digest.FromBytes(tarB)
+
+	for _, tt := range []struct {
+		name     string
+		layers   []v1.Descriptor
+		diffIDs  []digest.Digest
+		history  []v1.History
+		blobs    schema.BlobProvider
+		pointers []string
+		message  string
+	}{
+		{
+			name:    "uncompressed layer without blobs",
+			layers:  []v1.Descriptor{plainA},
+			diffIDs: []digest.Digest{diffA},
+		},
+		{
+			name:    "compressed layers",
+			layers:  []v1.Descriptor{gzipA, gzipB},
+			diffIDs: []digest.Digest{diffA, diffB},
+			history: []v1.History{{CreatedBy: "a"}, {EmptyLayer: true}, {CreatedBy: "b"}},
+			blobs:   blobs,
+		},
+		{
+			name:    "compressed layers without blobs are not checked",
+			layers:  []v1.Descriptor{gzipA},
+			diffIDs: []digest.Digest{diffB},
+		},
+		{
+			name:     "count mismatch",
+			layers:   []v1.Descriptor{plainA},
+			diffIDs:  []digest.Digest{diffA, diffB},
+			pointers: []string{"/rootfs/diff_ids"},
+		},
+		{
+			name:     "history mismatch",
+			layers:   []v1.Descriptor{plainA},
+			diffIDs:  []digest.Digest{diffA},
+			history:  []v1.History{{CreatedBy: "a"}, {CreatedBy: "b"}},
+			pointers: []string{"/history"},
+		},
+		{
+			name:     "digest mismatch",
+			layers:   []v1.Descriptor{gzipA},
+			diffIDs:  []digest.Digest{diffB},
+			blobs:    blobs,
+			pointers: []string{"/rootfs/diff_ids/0"},
+			message:  "has DiffID",
+		},
+		{
+			name:     "order mismatch",
+			layers:   []v1.Descriptor{gzipB, gzipA},
+			diffIDs:  []digest.Digest{diffA, diffB},
+			blobs:    blobs,
+			pointers: []string{"/rootfs/diff_ids/0", "/rootfs/diff_ids/1"},
+			message:  "out of order",
+		},
+		{
+			name:     "missing blob",
+			layers:   []v1.Descriptor{gzipA},
+			diffIDs:  []digest.Digest{diffA},
+			blobs:    memoryBlobs{},
+			pointers: []string{"/rootfs/diff_ids/0"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := v1.Manifest{Layers: tt.layers}
+			config := v1.Image{
+				RootFS:  v1.RootFS{Type: "layers", DiffIDs: tt.diffIDs},
+				History: tt.history,
+			}
+
+			err := schema.ValidateRootFS(manifest, config, tt.blobs)
+			if len(tt.pointers) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			verr, ok := errors.Cause(err).(schema.ValidationError)
+			if !ok {
+				t.Fatalf("expected a validation error but got %v", err)
+			}
+			if len(verr.Findings) != len(tt.pointers) {
+				t.Fatalf("expected findings at %v but got %v", tt.pointers, verr.Findings)
+			}
+			for i, f := range verr.Findings {
+				if f.Pointer != tt.pointers[i] {
+					t.Errorf("expected finding at %s but got %v", tt.pointers[i], f)
+				}
+				if !strings.Contains(f.Message, tt.message) {
+					t.Errorf("expected finding %q to contain %q", f.Message, tt.message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+// A Rule is the stable identifier of a SHOULD-level requirement
+// of the specification. Violations of a rule are reported as warnings,
+// or as errors in strict mode.
+type Rule string
+
+// Rules checked by the validators.
+const (
+	// RuleConfigMediaType is violated by a manifest config
+	// with a media type other than the OCI image config media type.
+	RuleConfigMediaType Rule = "config-media-type"
+
+	// RuleLayerMediaType is violated by a manifest layer
+	// with a media type other than the OCI layer media types.
+	RuleLayerMediaType Rule = "layer-media-type"
+
+	// RuleManifestMediaType is violated by an index entry
+	// with a media type other than the OCI image manifest media type.
+	RuleManifestMediaType Rule = "manifest-media-type"
+
+	// RuleDigestAlgorithm is violated by a digest using an algorithm
+	// which is not registered with the specification.
+	RuleDigestAlgorithm Rule = "digest-algorithm"
+
+	// RulePlatform is violated by an unknown operating system
+	// or an invalid operating system and architecture pair.
+	RulePlatform Rule = "platform"
+
+	// RuleCanonicalJSON is violated by JSON content
+	// which is not serialized as canonical JSON.
+	RuleCanonicalJSON Rule = "canonical-json"
+
+	// RuleLayerSparseFile is violated by a layer containing sparse files.
+	RuleLayerSparseFile Rule = "layer-sparse-file"
+)
+
+// allowed reports whether the rule is exempt from strict mode.
+func (o Options) allowed(rule Rule) bool {
+	for _, r := range o.Allow {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
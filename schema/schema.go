@@ -16,25 +16,41 @@ package schema
 
 import (
 	"net/http"
+	"sort"
+	"strings"
 
+	imagespecs "github.com/opencontainers/image-spec/specs-go"
 	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 )
 
 // Media types for the OCI image formats
 const (
-	ValidatorMediaTypeDescriptor   Validator     = v1.MediaTypeDescriptor
-	ValidatorMediaTypeLayoutHeader Validator     = v1.MediaTypeLayoutHeader
-	ValidatorMediaTypeManifest     Validator     = v1.MediaTypeImageManifest
-	ValidatorMediaTypeImageIndex   Validator     = v1.MediaTypeImageIndex
-	ValidatorMediaTypeImageConfig  Validator     = v1.MediaTypeImageConfig
-	ValidatorMediaTypeImageLayer   unimplemented = v1.MediaTypeImageLayer
+	ValidatorMediaTypeDescriptor                     Validator = v1.MediaTypeDescriptor
+	ValidatorMediaTypeLayoutHeader                   Validator = v1.MediaTypeLayoutHeader
+	ValidatorMediaTypeManifest                       Validator = v1.MediaTypeImageManifest
+	ValidatorMediaTypeImageIndex                     Validator = v1.MediaTypeImageIndex
+	ValidatorMediaTypeImageConfig                    Validator = v1.MediaTypeImageConfig
+	ValidatorMediaTypeImageLayer                     Validator = v1.MediaTypeImageLayer
+	ValidatorMediaTypeImageLayerGzip                 Validator = v1.MediaTypeImageLayerGzip
+	ValidatorMediaTypeImageLayerNonDistributable     Validator = v1.MediaTypeImageLayerNonDistributable
+	ValidatorMediaTypeImageLayerNonDistributableGzip Validator = v1.MediaTypeImageLayerNonDistributableGzip
 )
 
 var (
 	// fs stores the embedded http.FileSystem
-	// having the OCI JSON schema files in root "/".
+	// having the OCI JSON schema files in root "/"
+	// and those of other releases in "/v<version>/".
 	fs = _escFS(false)
 
+	// versions maps spec releases to the directory of their schema files in fs.
+	// The schema files in root "/" are those of imagespecs.Version.
+	versions = map[string]string{
+		imagespecs.Version: "/",
+		"1.1.0":            "/v1.1.0/",
+		"1.1.1":            "/v1.1.1/",
+	}
+
 	// specs maps OCI schema media types to schema files.
 	specs = map[Validator]string{
 		ValidatorMediaTypeDescriptor:   "content-descriptor.json",
@@ -46,7 +62,32 @@ var (
 )
 
 // FileSystem returns an in-memory filesystem including the schema files.
-// The schema files are located at the root directory.
+// The schema files of imagespecs.Version are located at the root directory,
+// those of other releases in a "v<version>" directory, for example "/v1.1.0".
 func FileSystem() http.FileSystem {
 	return fs
 }
+
+// Versions returns the spec releases whose schema files are embedded,
+// sorted lexically. Each of them can be selected with Options.Version.
+func Versions() []string {
+	vs := make([]string, 0, len(versions))
+	for v := range versions {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// schemaDir returns the directory of the schema files of version in fs.
+// A leading "v" is ignored and the empty string selects imagespecs.Version.
+func schemaDir(version string) (string, error) {
+	if version == "" {
+		version = imagespecs.Version
+	}
+	dir, ok := versions[strings.TrimPrefix(version, "v")]
+	if !ok {
+		return "", errors.Errorf("no schema files for spec version %q", version)
+	}
+	return dir, nil
+}
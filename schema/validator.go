@@ -21,6 +21,7 @@ import (
 	"io"
 	"io/ioutil"
 	"regexp"
+	"strconv"
 
 	digest "github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go/v1"
@@ -30,9 +31,10 @@ import (
 
 // Validator wraps a media type string identifier
 // and implements validation against a JSON schema.
+// Layer media types are validated against the rules of layer.md instead.
 type Validator string
 
-type validateFunc func(r io.Reader) error
+type validateFunc func(r io.Reader, rep *report) error
 
 var mapValidate = map[Validator]validateFunc{
 	ValidatorMediaTypeImageConfig: validateConfig,
@@ -44,6 +46,9 @@ var mapValidate = map[Validator]validateFunc{
 // ValidationError contains all the errors that happened during validation.
 type ValidationError struct {
 	Errs []error
+
+	// Findings holds the structured form of the schema violations in Errs.
+	Findings []Finding
 }
 
 func (e ValidationError) Error() string {
@@ -51,23 +56,77 @@ func (e ValidationError) Error() string {
 }
 
 // Validate validates the given reader against the schema of the wrapped media type.
+// Warnings are discarded; use ValidateWithOptions to collect them.
 func (v Validator) Validate(src io.Reader) error {
+	_, err := v.ValidateWithOptions(src, Options{})
+	return err
+}
+
+// ValidateWithOptions validates the given reader against the schema of the wrapped media type.
+// It returns the warnings found during validation next to the validation error, if any.
+// Nothing is ever written to stdout or stderr.
+func (v Validator) ValidateWithOptions(src io.Reader, opts Options) ([]Finding, error) {
+	if gzipped, ok := layerValidators[v]; ok {
+		rep := newReport(nil, opts)
+		err := validateLayer(src, gzipped, rep)
+		return rep.warnings, rep.merge(err)
+	}
+
 	buf, err := ioutil.ReadAll(src)
 	if err != nil {
-		return errors.Wrap(err, "unable to read the document file")
+		return nil, errors.Wrap(err, "unable to read the document file")
 	}
 
-	if f, ok := mapValidate[v]; ok {
-		if f == nil {
-			return fmt.Errorf("internal error: mapValidate[%q] is nil", v)
-		}
-		err = f(bytes.NewReader(buf))
+	rep := newReport(buf, opts)
+	err = v.validate(buf, rep)
+	return rep.warnings, rep.merge(err)
+}
+
+// isLayer reports whether v validates layer tar archives.
+func (v Validator) isLayer() bool {
+	_, ok := layerValidators[v]
+	return ok
+}
+
+// isDocument reports whether v validates JSON documents.
+func (v Validator) isDocument() bool {
+	if _, ok := specs[v]; ok {
+		return true
+	}
+	_, ok := v.registered()
+	return ok
+}
+
+// schema returns the semantic check and the JSON schema loader for v.
+// The schema files of OCI media types are taken from the given spec version.
+func (v Validator) schema(version string) (validateFunc, gojsonschema.JSONLoader, error) {
+	if r, ok := v.registered(); ok {
+		return r.check, r.loader(), nil
+	}
+
+	dir, err := schemaDir(version)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "schema %s", v)
+	}
+
+	f := mapValidate[v]
+	return f, gojsonschema.NewReferenceLoaderFileSystem("file://"+dir+specs[v], fs), nil
+}
+
+func (v Validator) validate(buf []byte, rep *report) error {
+	f, sl, err := v.schema(rep.opts.Version)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		err := f(bytes.NewReader(buf), rep)
 		if err != nil {
 			return err
 		}
 	}
 
-	sl := gojsonschema.NewReferenceLoaderFileSystem("file:///"+specs[v], fs)
+	checkCanonical(buf, rep)
+
 	ml := gojsonschema.NewStringLoader(string(buf))
 
 	result, err := gojsonschema.Validate(sl, ml)
@@ -82,22 +141,19 @@ func (v Validator) Validate(src io.Reader) error {
 	}
 
 	errs := make([]error, 0, len(result.Errors()))
+	findings := make([]Finding, 0, len(result.Errors()))
 	for _, desc := range result.Errors() {
 		errs = append(errs, fmt.Errorf("%s", desc))
+		findings = append(findings, newFinding(buf, desc))
 	}
 
 	return ValidationError{
-		Errs: errs,
+		Errs:     errs,
+		Findings: findings,
 	}
 }
 
-type unimplemented string
-
-func (v unimplemented) Validate(src io.Reader) error {
-	return fmt.Errorf("%s: unimplemented", v)
-}
-
-func validateManifest(r io.Reader) error {
+func validateManifest(r io.Reader, rep *report) error {
 	header := v1.Manifest{}
 
 	buf, err := ioutil.ReadAll(r)
@@ -107,25 +163,27 @@ func validateManifest(r io.Reader) error {
 
 	err = json.Unmarshal(buf, &header)
 	if err != nil {
-		return errors.Wrap(err, "manifest format mismatch")
+		return formatMismatch(buf, err, "manifest")
 	}
 
 	if header.Config.MediaType != string(v1.MediaTypeImageConfig) {
-		fmt.Printf("warning: config %s has an unknown media type: %s\n", header.Config.Digest, header.Config.MediaType)
+		rep.warnf(RuleConfigMediaType, []string{"config", "mediaType"}, header.Config.MediaType,
+			"config %s has an unknown media type: %s", header.Config.Digest, header.Config.MediaType)
 	}
 
-	for _, layer := range header.Layers {
+	for i, layer := range header.Layers {
 		if layer.MediaType != string(v1.MediaTypeImageLayer) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerGzip) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerNonDistributable) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerNonDistributableGzip) {
-			fmt.Printf("warning: layer %s has an unknown media type: %s\n", layer.Digest, layer.MediaType)
+			rep.warnf(RuleLayerMediaType, []string{"layers", strconv.Itoa(i), "mediaType"}, layer.MediaType,
+				"layer %s has an unknown media type: %s", layer.Digest, layer.MediaType)
 		}
 	}
 	return nil
 }
 
-func validateDescriptor(r io.Reader) error {
+func validateDescriptor(r io.Reader, rep *report) error {
 	header := v1.Descriptor{}
 
 	buf, err := ioutil.ReadAll(r)
@@ -135,19 +193,19 @@ func validateDescriptor(r io.Reader) error {
 
 	err = json.Unmarshal(buf, &header)
 	if err != nil {
-		return errors.Wrap(err, "descriptor format mismatch")
+		return formatMismatch(buf, err, "descriptor")
 	}
 
 	err = header.Digest.Validate()
 	if err == digest.ErrDigestUnsupported {
 		// we ignore unsupported algorithms
-		fmt.Printf("warning: unsupported digest: %q: %v\n", header.Digest, err)
+		rep.warnf(RuleDigestAlgorithm, []string{"digest"}, header.Digest.String(), "unsupported digest: %q: %v", header.Digest, err)
 		return nil
 	}
 	return err
 }
 
-func validateIndex(r io.Reader) error {
+func validateIndex(r io.Reader, rep *report) error {
 	header := v1.Index{}
 
 	buf, err := ioutil.ReadAll(r)
@@ -157,15 +215,17 @@ func validateIndex(r io.Reader) error {
 
 	err = json.Unmarshal(buf, &header)
 	if err != nil {
-		return errors.Wrap(err, "index format mismatch")
+		return formatMismatch(buf, err, "index")
 	}
 
-	for _, manifest := range header.Manifests {
+	for i, manifest := range header.Manifests {
+		index := strconv.Itoa(i)
 		if manifest.MediaType != string(v1.MediaTypeImageManifest) {
-			fmt.Printf("warning: manifest %s has an unknown media type: %s\n", manifest.Digest, manifest.MediaType)
+			rep.warnf(RuleManifestMediaType, []string{"manifests", index, "mediaType"}, manifest.MediaType,
+				"manifest %s has an unknown media type: %s", manifest.Digest, manifest.MediaType)
 		}
 		if manifest.Platform != nil {
-			checkPlatform(manifest.Platform.OS, manifest.Platform.Architecture)
+			checkPlatform(rep, []string{"manifests", index, "platform"}, manifest.Platform.OS, manifest.Platform.Architecture)
 		}
 
 	}
@@ -173,7 +233,7 @@ func validateIndex(r io.Reader) error {
 	return nil
 }
 
-func validateConfig(r io.Reader) error {
+func validateConfig(r io.Reader, rep *report) error {
 	header := v1.Image{}
 
 	buf, err := ioutil.ReadAll(r)
@@ -183,10 +243,10 @@ func validateConfig(r io.Reader) error {
 
 	err = json.Unmarshal(buf, &header)
 	if err != nil {
-		return errors.Wrap(err, "config format mismatch")
+		return formatMismatch(buf, err, "config")
 	}
 
-	checkPlatform(header.OS, header.Architecture)
+	checkPlatform(rep, nil, header.OS, header.Architecture)
 
 	envRegexp := regexp.MustCompile(`^[^=]+=.*$`)
 	for _, e := range header.Config.Env {
@@ -198,7 +258,9 @@ func validateConfig(r io.Reader) error {
 	return nil
 }
 
-func checkPlatform(OS string, Architecture string) {
+// checkPlatform warns about unknown platforms. The tokens address
+// the object holding the "os" and "architecture" fields.
+func checkPlatform(rep *report, tokens []string, OS string, Architecture string) {
 	validCombins := map[string][]string{
 		"android":   {"arm"},
 		"darwin":    {"386", "amd64", "arm", "arm64"},
@@ -217,8 +279,9 @@ func checkPlatform(OS string, Architecture string) {
 					return
 				}
 			}
-			fmt.Printf("warning: combination of %q and %q is invalid.", OS, Architecture)
+			rep.warnf(RulePlatform, append(tokens, "architecture"), Architecture, "combination of %q and %q is invalid", OS, Architecture)
+			return
 		}
 	}
-	fmt.Printf("warning: operating system %q of the bundle is not supported yet.", OS)
+	rep.warnf(RulePlatform, append(tokens, "os"), OS, "operating system %q of the bundle is not supported yet", OS)
 }
@@ -0,0 +1,93 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+)
+
+func TestVersions(t *testing.T) {
+	versions := schema.Versions()
+	for _, want := range []string{specs.Version, "1.1.0", "1.1.1"} {
+		found := false
+		for _, v := range versions {
+			found = found || v == want
+		}
+		if !found {
+			t.Errorf("expected version %s in %v", want, versions)
+		}
+	}
+
+	for _, v := range versions {
+		for _, validator := range []schema.Validator{schema.ValidatorMediaTypeLayoutHeader, schema.ValidatorMediaTypeImageIndex} {
+			_, err := validator.ValidateWithOptions(strings.NewReader(`{}`), schema.Options{Version: v})
+			if _, ok := err.(schema.ValidationError); !ok {
+				t.Errorf("version %s: expected the %s schema to reject {} but got %v", v, validator, err)
+			}
+		}
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	const digest = `"sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270"`
+
+	for i, tt := range []struct {
+		validator schema.Validator
+		document  string
+		versions  map[string]bool
+	}{
+		// the data field was introduced in 1.1.0
+		{
+			validator: schema.ValidatorMediaTypeDescriptor,
+			document:  `{"mediaType": "application/vnd.oci.image.manifest.v1+json", "size": 1, "digest": ` + digest + `, "data": 1}`,
+			versions:  map[string]bool{"": true, specs.Version: true, "1.1.0": false, "v1.1.0": false},
+		},
+
+		// the variant field was introduced in 1.1.0
+		{
+			validator: schema.ValidatorMediaTypeImageConfig,
+			document:  `{"architecture": "arm", "os": "linux", "variant": 7, "rootfs": {"type": "layers", "diff_ids": []}}`,
+			versions:  map[string]bool{"": true, specs.Version: true, "1.1.0": false, "1.1.1": false},
+		},
+
+		// 1.1.1 fixed a character range in the mediaType pattern
+		{
+			validator: schema.ValidatorMediaTypeDescriptor,
+			document:  `{"mediaType": "application/vnd.example;v=1", "size": 1, "digest": ` + digest + `}`,
+			versions:  map[string]bool{"": true, "1.1.0": true, "1.1.1": false},
+		},
+	} {
+		for version, valid := range tt.versions {
+			_, err := tt.validator.ValidateWithOptions(strings.NewReader(tt.document), schema.Options{Version: version})
+			if got := err == nil; got != valid {
+				t.Errorf("test %d: version %q: expected valid=%t but got error %v", i, version, valid, err)
+			}
+		}
+	}
+}
+
+func TestValidateUnknownVersion(t *testing.T) {
+	// releases without their own schema files are not guessed
+	for _, version := range []string{"0.5.0", "1.0.2"} {
+		_, err := schema.ValidatorMediaTypeImageIndex.ValidateWithOptions(strings.NewReader(`{}`), schema.Options{Version: version})
+		if err == nil || !strings.Contains(err.Error(), `"`+version+`"`) {
+			t.Errorf("expected an error for the unknown version %s but got %v", version, err)
+		}
+	}
+}